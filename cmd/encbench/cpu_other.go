@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "time"
+
+var started = time.Now()
+
+// cpuTime falls back to wall time where getrusage is unavailable; it is
+// only comparable between modes with GOMAXPROCS=1.
+func cpuTime() time.Duration { return time.Since(started) }
@@ -0,0 +1,105 @@
+// Command encbench measures what stream serialization costs at high
+// fan-out: every subscriber turns each event into an SSE frame, either by
+// marshalling it per connection (the old path) or through the event's
+// shared Wire cache. It reports CPU time and allocations per mode.
+//
+//	go run ./cmd/encbench -subs 2000 -events 2000 [-fields orderId,status] [-encoding compact]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"orderpulse-api/internal/models"
+	"orderpulse-api/internal/stream"
+)
+
+func main() {
+	subs := flag.Int("subs", 2000, "subscribers")
+	events := flag.Int("events", 2000, "events to publish")
+	buf := flag.Int("buf", 256, "subscriber buffer")
+	fields := flag.String("fields", "", "projection, as ?fields=")
+	encoding := flag.String("encoding", "", "json or compact, as ?encoding=")
+	flag.Parse()
+
+	proj, err := stream.ParseProjection(*fields, *encoding)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	fmt.Printf("%d subscribers x %d events, GOMAXPROCS %d\n", *subs, *events, runtime.GOMAXPROCS(0))
+
+	// perConn is what SSE did before the cache: each connection encodes
+	// and frames the event itself, under the same projection. A nil Wire
+	// caches nothing.
+	perConn := func(ev models.OrderEvent) []byte {
+		ev.Wire = nil
+		return stream.SSEFrame(proj, ev)
+	}
+	cached := func(ev models.OrderEvent) []byte { return stream.SSEFrame(proj, ev) }
+
+	base := run("per-connection", *subs, *events, *buf, perConn)
+	shared := run("shared", *subs, *events, *buf, cached)
+	fmt.Printf("CPU saved %.0f%%\n", 100*(1-shared.Seconds()/base.Seconds()))
+}
+
+// run publishes events to subs block-policy subscribers that frame each
+// one with encode, and returns the CPU time used.
+func run(name string, subs, events, buf int, encode func(models.OrderEvent) []byte) time.Duration {
+	hub := stream.NewHub(nil)
+	defer hub.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		wg        sync.WaitGroup
+		delivered atomic.Int64
+	)
+	for range subs {
+		ch := hub.Subscribe(ctx, buf, stream.Policy(stream.Block, time.Minute))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ev := range ch {
+				_, _ = io.Discard.Write(encode(ev))
+				delivered.Add(1)
+			}
+		}()
+	}
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	cpu0 := cpuTime()
+	start := time.Now()
+	for i := range events {
+		ev := models.OrderEvent{
+			ID: fmt.Sprint(i), OrderID: fmt.Sprintf("o-%d", i%500), Type: "status_changed", Status: "paid",
+			Amount: 100 + i, TS: time.Now(), Attrs: map[string]string{"merchant": "m-42"},
+		}
+		if err := hub.Publish(ev); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	// Block never drops, so every subscriber sees every event.
+	for delivered.Load() < int64(subs)*int64(events) {
+		time.Sleep(time.Millisecond)
+	}
+	wall := time.Since(start)
+	cpu := cpuTime() - cpu0
+	runtime.ReadMemStats(&after)
+	cancel()
+	wg.Wait()
+
+	n := float64(subs) * float64(events)
+	fmt.Printf("%-15s wall %v, CPU %v (%.0f ns/delivery), alloc %.1f MB (%.0f B/delivery)\n", name,
+		wall.Round(time.Millisecond), cpu.Round(time.Millisecond), float64(cpu.Nanoseconds())/n,
+		float64(after.TotalAlloc-before.TotalAlloc)/1e6, float64(after.TotalAlloc-before.TotalAlloc)/n)
+	return cpu
+}
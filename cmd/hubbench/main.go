@@ -0,0 +1,154 @@
+// Command hubbench measures stream.Hub fan-out: a fixed number of draining
+// subscribers and a publisher at a target rate, reporting delivered events
+// per second, end-to-end latency percentiles and drops.
+//
+//	go run ./cmd/hubbench -subs 10000 -rate 5000 -duration 10s
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"orderpulse-api/internal/models"
+	"orderpulse-api/internal/stream"
+)
+
+func main() {
+	subs := flag.Int("subs", 10000, "subscribers")
+	rate := flag.Int("rate", 5000, "events per second (0 = as fast as possible)")
+	dur := flag.Duration("duration", 10*time.Second, "publish duration")
+	buf := flag.Int("buf", 256, "subscriber buffer")
+	shards := flag.Int("shards", 0, "hub shards (0 = default)")
+	filtered := flag.Float64("filtered", 0, "fraction of subscribers filtering on a single status")
+	churn := flag.Int("churn", 0, "subscribe/unsubscribe pairs per second during the run")
+	flag.Parse()
+
+	var hub *stream.Hub
+	if *shards > 0 {
+		hub = stream.NewShardedHub(nil, *shards)
+	} else {
+		hub = stream.NewHub(nil)
+	}
+	defer hub.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		delivered atomic.Int64
+		mu        sync.Mutex
+		lat       []time.Duration
+		wg        sync.WaitGroup
+	)
+	statuses := []string{"pending", "paid", "packed", "shipped"}
+	start := time.Now()
+	for i := range *subs {
+		var opts []stream.SubOption
+		if float64(i) < *filtered*float64(*subs) {
+			opts = append(opts, stream.Filtered(stream.Filter{Statuses: []string{statuses[i%len(statuses)]}}))
+		}
+		ch := hub.Subscribe(ctx, *buf, opts...)
+		sample := i%100 == 0
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var local []time.Duration
+			for ev := range ch {
+				delivered.Add(1)
+				if sample {
+					local = append(local, time.Since(ev.TS))
+				}
+			}
+			mu.Lock()
+			lat = append(lat, local...)
+			mu.Unlock()
+		}()
+	}
+	fmt.Printf("subscribed %d in %v (%d shards, GOMAXPROCS %d)\n", *subs, time.Since(start).Round(time.Millisecond), hubShards(*shards), runtime.GOMAXPROCS(0))
+
+	if *churn > 0 {
+		go func() {
+			t := time.NewTicker(time.Second / time.Duration(*churn))
+			defer t.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-t.C:
+					c, stop := context.WithCancel(ctx)
+					hub.Subscribe(c, 16)
+					stop()
+				}
+			}
+		}()
+	}
+
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	published := 0
+	perStatus := make([]int64, len(statuses))
+	start = time.Now()
+	var tick <-chan time.Time
+	if *rate > 0 {
+		t := time.NewTicker(time.Second / time.Duration(*rate))
+		defer t.Stop()
+		tick = t.C
+	}
+	for time.Since(start) < *dur {
+		if tick != nil {
+			<-tick
+		}
+		ev := models.OrderEvent{ID: fmt.Sprint(published), OrderID: "o", Type: "status_changed", Status: statuses[published%len(statuses)], TS: time.Now()}
+		if err := hub.Publish(ev); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		perStatus[published%len(statuses)]++
+		published++
+	}
+	pubDur := time.Since(start)
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	slices.Sort(lat)
+	pct := func(p float64) time.Duration {
+		if len(lat) == 0 {
+			return 0
+		}
+		return lat[min(len(lat)-1, int(p*float64(len(lat))))].Round(time.Microsecond)
+	}
+	fmt.Printf("published %d events in %v (%.0f/s)\n", published, pubDur.Round(time.Millisecond), float64(published)/pubDur.Seconds())
+	fmt.Printf("delivered %d (%.0f/s), dropped %d\n", delivered.Load(), float64(delivered.Load())/elapsed.Seconds(), expected(published, perStatus, *subs, *filtered)-delivered.Load())
+	fmt.Printf("latency p50 %v p99 %v max %v\n", pct(0.5), pct(0.99), pct(1))
+	fmt.Printf("alloc %.1f MB, GC cycles %d\n", float64(after.TotalAlloc-before.TotalAlloc)/1e6, after.NumGC-before.NumGC)
+}
+
+func hubShards(n int) int {
+	if n > 0 {
+		return n
+	}
+	return max(4, runtime.GOMAXPROCS(0))
+}
+
+// expected is the delivery count with no drops; filtered subscriber i only
+// sees events with status i mod len(statuses).
+func expected(published int, perStatus []int64, subs int, filtered float64) int64 {
+	var n int64
+	for i := range subs {
+		if float64(i) < filtered*float64(subs) {
+			n += perStatus[i%len(perStatus)]
+		} else {
+			n += int64(published)
+		}
+	}
+	return n
+}
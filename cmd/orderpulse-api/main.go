@@ -1,26 +1,46 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"net/http"
 	"os/signal"
+	"slices"
 	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"orderpulse-api/internal/cluster"
+	"orderpulse-api/internal/codec"
 	"orderpulse-api/internal/config"
+	"orderpulse-api/internal/deadletter"
+	"orderpulse-api/internal/dedup"
 	httpx "orderpulse-api/internal/http"
+	"orderpulse-api/internal/input"
+	fin "orderpulse-api/internal/input/file"
 	kcons "orderpulse-api/internal/input/kafka"
+	ncons "orderpulse-api/internal/input/nats"
 	acons "orderpulse-api/internal/input/rabbitmq"
+	rcons "orderpulse-api/internal/input/redis"
+	"orderpulse-api/internal/leader"
 	"orderpulse-api/internal/logstore"
+	"orderpulse-api/internal/mapping"
+	"orderpulse-api/internal/output"
+	"orderpulse-api/internal/pipeline"
+	"orderpulse-api/internal/quota"
 	"orderpulse-api/internal/stream"
+	"orderpulse-api/internal/subscription"
+	"orderpulse-api/internal/webhook"
 )
 
 func main() {
 	zerolog.TimeFieldFormat = time.RFC3339
 	cfg := config.New()
+	if len(cfg.JWTKeys) == 0 {
+		log.Warn().Msg("JWT_KEYS unset: streams accept any token; ingest, subscriptions and admin endpoints refuse every request")
+	}
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
@@ -30,30 +50,198 @@ func main() {
 		log.Fatal().Err(err).Msg("logstore")
 	}
 
-	hub := stream.NewHub(store)
+	store.SetSync(cfg.LogFsync)
+	writer := logstore.NewWriter(store, cfg.LogQueue, cfg.LogBatch)
+	persist, err := stream.ParsePersistence(cfg.LogPersist)
+	if err != nil {
+		log.Fatal().Err(err).Msg("LOG_PERSIST")
+	}
+
+	if cfg.NodeID == "" && (cfg.ClusterBus != "" || cfg.LeaderLock != "") {
+		log.Fatal().Msg("NODE_ID must be set (and unique) with CLUSTER_BUS or LEADER_LOCK")
+	}
+
+	hub := stream.NewHub(writer)
+	hub.SetPersistence(persist)
+	slow, err := stream.ParseSlowPolicy(cfg.StreamSlowPolicy)
+	if err != nil {
+		log.Fatal().Err(err).Msg("STREAM_SLOW_POLICY")
+	}
+	hub.SetSlowPolicy(slow, cfg.StreamBlockTimeout)
+	if cfg.ReorderEnabled {
+		policy := stream.LatePolicy(cfg.ReorderLate)
+		if policy != stream.LateTag && policy != stream.LateDrop {
+			log.Fatal().Str("policy", cfg.ReorderLate).Msg("unknown REORDER_LATE")
+		}
+		hub.StartReorder(ctx, cfg.ReorderLateness, policy)
+	}
+	// The bridge publishes remote events, so the hub must be fully set up.
+	if cfg.ClusterBus != "" {
+		var bus cluster.Bus
+		switch cfg.ClusterBus {
+		case "redis":
+			bus = cluster.NewRedis(cmp.Or(cfg.ClusterURL, cfg.RedisAddr), cfg.RedisPassword, cfg.ClusterSubject)
+		case "nats":
+			if bus, err = cluster.NewNATS(cmp.Or(cfg.ClusterURL, cfg.NatsURL), cfg.ClusterSubject); err != nil {
+				log.Fatal().Err(err).Msg("cluster bus")
+			}
+		default:
+			log.Fatal().Str("bus", cfg.ClusterBus).Msg("unknown CLUSTER_BUS")
+		}
+		defer bus.Close()
+		hub.SetNode(cfg.NodeID)
+		log.Info().Str("node", cfg.NodeID).Str("bus", cfg.ClusterBus).Msg("cluster")
+		(&cluster.Bridge{Node: cfg.NodeID, Bus: bus, Hub: hub, BackoffMax: cfg.BackoffMax}).Start(ctx)
+	}
+
+	var reg *codec.Registry
+	if cfg.SchemaRegistryURL != "" {
+		reg = codec.NewRegistry(cfg.SchemaRegistryURL, cfg.SchemaRegistryUser, cfg.SchemaRegistryPass)
+	}
+	codecs := codec.NewSet(reg)
+	mappers := map[string]*mapping.Mapper{}
+	if cfg.MappingConfig != "" {
+		if mappers, err = mapping.Load(cfg.MappingConfig); err != nil {
+			log.Fatal().Err(err).Msg("mapping")
+		}
+	}
+	dlq, err := deadletter.New(cfg.DeadLetterPath)
+	if err != nil {
+		log.Fatal().Err(err).Msg("deadletter")
+	}
+	decoder := func(name, format string) *input.Decoder {
+		f, err := codec.ParseFormat(format)
+		if err != nil {
+			log.Fatal().Err(err).Str("input", name).Msg("format")
+		}
+		d := input.NewDecoder(name, codecs, f)
+		d.Mapper = mappers[name]
+		d.DeadLetter = dlq
+		return d
+	}
 
+	sup := input.NewSupervisor(hub, cfg.BackoffMax, cfg.InputMaxFailures)
+	var elector *leader.Elector
+	if cfg.LeaderLock != "" {
+		var lock leader.Lock
+		switch cfg.LeaderLock {
+		case "file":
+			if lock, err = leader.NewFileLock(cfg.LeaderPath, cfg.NodeID); err != nil {
+				log.Fatal().Err(err).Msg("leader lock")
+			}
+		case "redis":
+			lock = leader.NewRedisLease(cfg.RedisAddr, cfg.RedisPassword, cfg.LeaderKey, cfg.NodeID)
+		default:
+			log.Fatal().Str("lock", cfg.LeaderLock).Msg("unknown LEADER_LOCK")
+		}
+		if elector, err = leader.New(cfg.NodeID, lock, cfg.LeaderTTL); err != nil {
+			log.Fatal().Err(err).Msg("leader election")
+		}
+		go elector.Run(ctx)
+	}
+	// add gates SINGLETON_INPUTS on leadership when an election is configured.
+	add := func(name string, src input.Source) {
+		if elector != nil && slices.Contains(cfg.SingletonInputs, name) {
+			sup.AddGated(name, src, elector)
+			return
+		}
+		sup.Add(name, src)
+	}
+	if cfg.PipelineConfig != "" {
+		chains, err := pipeline.Load(cfg.PipelineConfig)
+		if err != nil {
+			log.Fatal().Err(err).Msg("pipeline")
+		}
+		sup.Use(pipeline.Middleware(chains, dlq))
+	}
+	var window *dedup.Window
+	if cfg.DedupEnabled {
+		if window, err = dedup.New(cfg.DedupTTL, cfg.DedupMax, cfg.DedupPath); err != nil {
+			log.Fatal().Err(err).Msg("dedup")
+		}
+		sup.Use(window.Middleware(cfg.DedupDisabled...))
+		go window.Persist(ctx, 30*time.Second)
+	}
 	if cfg.MockEnabled {
-		gen := &stream.Generator{Hub: hub}
-		go gen.Run(ctx)
+		add("mock", &stream.Generator{})
 	}
 	if cfg.KafkaEnabled && len(cfg.KafkaBrokers) > 0 {
-		go func() {
-			log.Info().Strs("brokers", cfg.KafkaBrokers).Str("topic", cfg.KafkaTopic).Msg("kafka consume")
-			if err := kcons.New(cfg.KafkaBrokers, cfg.KafkaTopic, cfg.KafkaGroup, hub).Run(ctx); err != nil {
-				log.Error().Err(err).Msg("kafka")
-			}
-		}()
+		log.Info().Strs("brokers", cfg.KafkaBrokers).Str("topic", cfg.KafkaTopic).Msg("kafka consume")
+		add("kafka", kcons.New(cfg.KafkaBrokers, cfg.KafkaTopic, cfg.KafkaGroup, decoder("kafka", cfg.KafkaFormat)))
 	}
 	if cfg.AmqpEnabled {
-		go func() {
-			log.Info().Str("queue", cfg.AmqpQueue).Msg("amqp consume")
-			if err := acons.New(cfg.AmqpURL, cfg.AmqpQueue, hub).Run(ctx); err != nil {
-				log.Error().Err(err).Msg("amqp")
+		log.Info().Str("queue", cfg.AmqpQueue).Msg("amqp consume")
+		add("amqp", acons.New(cfg.AmqpURL, cfg.AmqpQueue, decoder("amqp", cfg.AmqpFormat)))
+	}
+	if cfg.NatsEnabled {
+		opts := ncons.Options{URL: cfg.NatsURL, Subject: cfg.NatsSubject, Queue: cfg.NatsQueue, Stream: cfg.NatsStream, Durable: cfg.NatsDurable}
+		log.Info().Str("subject", opts.Subject).Str("stream", opts.Stream).Msg("nats consume")
+		add("nats", ncons.New(opts, decoder("nats", cfg.NatsFormat)))
+	}
+	if cfg.RedisEnabled {
+		opts := rcons.Options{
+			Addr: cfg.RedisAddr, Password: cfg.RedisPassword, Streams: cfg.RedisStreams,
+			Group: cfg.RedisGroup, Consumer: cfg.RedisConsumer, Field: cfg.RedisField, ClaimIdle: cfg.RedisClaimIdle,
+		}
+		log.Info().Strs("streams", opts.Streams).Str("group", opts.Group).Msg("redis consume")
+		add("redis", rcons.New(opts, decoder("redis", cfg.RedisFormat)))
+	}
+	if cfg.FileTailPath != "" {
+		log.Info().Str("path", cfg.FileTailPath).Msg("file tail")
+		add("file", fin.NewTailer(cfg.FileTailPath, cfg.FileTailOffset, cfg.FilePoll, decoder("file", cfg.FileFormat)))
+	}
+	if cfg.FileWatchDir != "" {
+		log.Info().Str("dir", cfg.FileWatchDir).Msg("dir watch")
+		add("dir", fin.NewWatcher(cfg.FileWatchDir, cfg.FileWatchPattern, cfg.FilePoll, decoder("dir", cfg.FileFormat)))
+	}
+	sup.Start(context.Background())
+
+	if cfg.OutputsConfig != "" {
+		fwds, err := output.Load(cfg.OutputsConfig)
+		if err != nil {
+			log.Fatal().Err(err).Msg("outputs")
+		}
+		for _, f := range fwds {
+			log.Info().Str("sink", f.Name).Msg("output")
+			go f.Run(ctx, hub)
+		}
+	}
+
+	svc := httpx.Services{Inputs: sup, Leader: elector, Quota: quota.New(quota.Config{
+		Subject:    quota.Limits{Streams: cfg.QuotaSubjectStreams, Rate: cfg.QuotaSubjectRate},
+		Tenant:     quota.Limits{Streams: cfg.QuotaTenantStreams, Rate: cfg.QuotaTenantRate},
+		MaxReplay:  cfg.QuotaMaxReplay,
+		RetryAfter: cfg.QuotaRetryAfter,
+	})}
+	if cfg.IngestEnabled {
+		svc.Ingest = decoder("http", "json")
+		// HTTP callers get rejections in the response instead.
+		svc.Ingest.DeadLetter = nil
+	}
+	if cfg.SubsEnabled {
+		opts := subscription.Options{Path: cfg.SubsPath, MaxFailures: cfg.SubsMaxFailures, MaxRetries: cfg.SubsMaxRetries,
+			AllowPrivate: cfg.SubsAllowPriv}
+		if svc.Subs, err = subscription.New(hub, opts); err != nil {
+			log.Fatal().Err(err).Msg("subscriptions")
+		}
+		svc.Subs.Start(ctx)
+	}
+	if len(cfg.Webhooks) > 0 {
+		var sources []webhook.Source
+		for _, ws := range cfg.Webhooks {
+			a, ok := webhook.Lookup(ws.Adapter)
+			if !ok {
+				log.Fatal().Str("source", ws.Name).Str("adapter", ws.Adapter).Msg("unknown webhook adapter")
 			}
-		}()
+			if len(ws.Secrets) == 0 {
+				log.Fatal().Str("source", ws.Name).Msg("webhook source has no secrets")
+			}
+			sources = append(sources, webhook.Source{Name: ws.Name, Adapter: a, Secrets: ws.Secrets})
+		}
+		svc.Hooks = webhook.NewReceiver(cfg.WebhookWindow, sources...)
 	}
 
-	srv := &http.Server{Addr: ":" + cfg.Port, Handler: httpx.Router(cfg, hub)}
+	srv := &http.Server{Addr: ":" + cfg.Port, Handler: httpx.Router(cfg, hub, svc)}
 	go func() {
 		log.Info().Str("addr", srv.Addr).Str("log", cfg.LogPath).Msg("listening")
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -62,7 +250,21 @@ func main() {
 	}()
 
 	<-ctx.Done()
+	sup.Stop(5 * time.Second)
+	if svc.Subs != nil {
+		if err := svc.Subs.Save(); err != nil {
+			log.Error().Err(err).Msg("subscriptions save")
+		}
+	}
+	if window != nil {
+		if err := window.Save(); err != nil {
+			log.Error().Err(err).Msg("dedup save")
+		}
+	}
 	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	_ = srv.Shutdown(shutdown)
+	hub.Close()
+	_ = writer.Close()
+	_ = store.Close()
 }
@@ -0,0 +1,123 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/models"
+	"orderpulse-api/internal/stream"
+)
+
+var (
+	sentCtr = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cluster_events_sent_total",
+		Help: "local events published to the cluster bus",
+	})
+	receivedCtr = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cluster_events_received_total",
+		Help: "events from other instances published to the local hub",
+	})
+	skippedCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cluster_events_skipped_total",
+		Help: "bus messages ignored",
+	}, []string{"reason"})
+	busErrCtr = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cluster_bus_errors_total",
+		Help: "cluster bus publish and subscribe failures",
+	})
+	droppedCtr = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cluster_events_dropped_total",
+		Help: "local events dropped because the cluster bus fell behind",
+	})
+)
+
+func init() { prometheus.MustRegister(sentCtr, receivedCtr, skippedCtr, busErrCtr, droppedCtr) }
+
+// Bridge joins a hub to the bus. The hub stamps local events with Node (see
+// Hub.SetNode); the bridge forwards only those, and publishes events from
+// other nodes locally with their origin intact, so nothing is sent twice and
+// no event loops between instances.
+type Bridge struct {
+	Node       string
+	Bus        Bus
+	Hub        *stream.Hub
+	BackoffMax time.Duration
+}
+
+// Start subscribes to the hub before returning, so nothing published after
+// it is missed, then runs until ctx is done. A slow or stalled bus must not
+// hold back the shard dispatchers, so once the bridge's buffer is full the
+// oldest unsent events are dropped and counted.
+func (b *Bridge) Start(ctx context.Context) {
+	local := func(ev models.OrderEvent) bool { return ev.Origin == b.Node }
+	lag := &stream.Lag{}
+	sub := b.Hub.Subscribe(ctx, 4096,
+		stream.Filtered(stream.Filter{Channels: []string{stream.AllChannels}}),
+		stream.Where(local),
+		stream.Policy(stream.DropOldest, 0),
+		stream.Track(lag))
+	go b.forward(ctx, sub, lag)
+	go b.receiveLoop(ctx)
+}
+
+func (b *Bridge) receiveLoop(ctx context.Context) {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := b.Bus.Subscribe(ctx, b.receive)
+		if ctx.Err() != nil {
+			return
+		}
+		busErrCtr.Inc()
+		if time.Since(start) > time.Minute {
+			backoff = time.Second
+		}
+		log.Warn().Err(err).Dur("retry", backoff).Msg("cluster subscribe")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, max(b.BackoffMax, time.Second))
+	}
+}
+
+func (b *Bridge) forward(ctx context.Context, sub stream.Subscriber, lag *stream.Lag) {
+	for ev := range sub {
+		if n := lag.Skipped(); n > 0 {
+			droppedCtr.Add(float64(n))
+			log.Warn().Uint64("dropped", n).Msg("cluster bus behind")
+		}
+		data, _ := json.Marshal(ev)
+		if err := b.Bus.Publish(ctx, data); err != nil {
+			busErrCtr.Inc()
+			log.Warn().Err(err).Str("id", ev.ID).Msg("cluster publish")
+			continue
+		}
+		sentCtr.Inc()
+	}
+}
+
+func (b *Bridge) receive(data []byte) {
+	var ev models.OrderEvent
+	if err := json.Unmarshal(data, &ev); err != nil {
+		skippedCtr.WithLabelValues("invalid").Inc()
+		return
+	}
+	switch ev.Origin {
+	case b.Node:
+		skippedCtr.WithLabelValues("self").Inc()
+		return
+	case "":
+		skippedCtr.WithLabelValues("no_origin").Inc()
+		return
+	}
+	if err := b.Hub.Publish(ev); err != nil {
+		log.Warn().Err(err).Str("origin", ev.Origin).Msg("cluster receive")
+		return
+	}
+	receivedCtr.Inc()
+}
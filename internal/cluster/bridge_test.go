@@ -0,0 +1,265 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"orderpulse-api/internal/models"
+	"orderpulse-api/internal/stream"
+)
+
+// countingBus counts what bridges publish onto it.
+type countingBus struct {
+	Bus
+	sent atomic.Int64
+}
+
+func (c *countingBus) Publish(ctx context.Context, data []byte) error {
+	c.sent.Add(1)
+	return c.Bus.Publish(ctx, data)
+}
+
+// node is one instance: a hub bridged to the bus, and a subscriber on it
+// that collects everything the hub delivers.
+type node struct {
+	hub *stream.Hub
+	got chan models.OrderEvent
+}
+
+func startNode(t *testing.T, ctx context.Context, name string, bus Bus) *node {
+	t.Helper()
+	hub := stream.NewHub(nil)
+	hub.SetNode(name)
+	t.Cleanup(hub.Close)
+	(&Bridge{Node: name, Bus: bus, Hub: hub}).Start(ctx)
+	n := &node{hub: hub, got: make(chan models.OrderEvent, 64)}
+	sub := hub.Subscribe(ctx, 64, stream.Filtered(stream.Filter{Channels: []string{stream.AllChannels}}))
+	go func() {
+		for ev := range sub {
+			n.got <- ev
+		}
+	}()
+	return n
+}
+
+// expect reads the want events from n in any order (events from different
+// nodes may interleave), then checks nothing else arrives.
+func (n *node) expect(t *testing.T, name string, want ...string) {
+	t.Helper()
+	missing := map[string]bool{}
+	for _, id := range want {
+		missing[id] = true
+	}
+	for len(missing) > 0 {
+		select {
+		case ev := <-n.got:
+			if !missing[ev.ID] {
+				t.Fatalf("%s got unexpected %s (origin %s)", name, ev.ID, ev.Origin)
+			}
+			delete(missing, ev.ID)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s never got %v", name, missing)
+		}
+	}
+	select {
+	case ev := <-n.got:
+		t.Fatalf("%s got %s (origin %s) again", name, ev.ID, ev.Origin)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func publish(t *testing.T, hub *stream.Hub, id string) {
+	t.Helper()
+	if err := hub.Publish(models.OrderEvent{ID: id, OrderID: "o-" + id, TS: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBridgeDeliversOnceWithoutLoops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mem := NewMemory()
+	bus := &countingBus{Bus: mem}
+	a := startNode(t, ctx, "a", bus)
+	b := startNode(t, ctx, "b", bus)
+	c := startNode(t, ctx, "c", bus)
+	waitSubscribers(t, mem, 3)
+
+	publish(t, a.hub, "e1")
+	publish(t, b.hub, "e2")
+	for name, n := range map[string]*node{"a": a, "b": b, "c": c} {
+		n.expect(t, name, "e1", "e2")
+	}
+	// One bus message per event: received events are never forwarded again.
+	if n := bus.sent.Load(); n != 2 {
+		t.Fatalf("bus carried %d messages, want 2", n)
+	}
+}
+
+func TestBridgeKeepsOrigin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mem := NewMemory()
+	a := startNode(t, ctx, "a", mem)
+	b := startNode(t, ctx, "b", mem)
+	waitSubscribers(t, mem, 2)
+
+	publish(t, a.hub, "e1")
+	a.expect(t, "a", "e1")
+	select {
+	case ev := <-b.got:
+		if ev.Origin != "a" {
+			t.Fatalf("origin %q, want a", ev.Origin)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("b never got e1")
+	}
+}
+
+func TestBridgeIgnoresForeignMessages(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mem := NewMemory()
+	a := startNode(t, ctx, "a", mem)
+	waitSubscribers(t, mem, 1)
+
+	for _, msg := range []string{`not json`, `{"id":"x1"}`, `{"id":"x2","origin":"a"}`, `{"id":"x3","origin":"z"}`} {
+		_ = mem.Publish(ctx, []byte(msg))
+	}
+	a.expect(t, "a", "x3")
+}
+
+// stalledBus accepts a publish only once release is closed.
+type stalledBus struct {
+	Bus
+	release chan struct{}
+}
+
+func (s *stalledBus) Publish(ctx context.Context, data []byte) error {
+	select {
+	case <-s.release:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return s.Bus.Publish(ctx, data)
+}
+
+func TestStalledBusDoesNotHoldBackLocalSubscribers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	bus := &stalledBus{Bus: NewMemory(), release: make(chan struct{})}
+	hub := stream.NewHub(nil)
+	hub.SetNode("a")
+	t.Cleanup(hub.Close)
+	(&Bridge{Node: "a", Bus: bus, Hub: hub}).Start(ctx)
+	const n = 6000 // more than the bridge buffers
+	sub := hub.Subscribe(ctx, n, stream.Filtered(stream.Filter{Channels: []string{stream.AllChannels}}))
+
+	dropped := testutil.ToFloat64(droppedCtr)
+	go func() {
+		for i := range n {
+			_ = hub.Publish(models.OrderEvent{ID: fmt.Sprint(i), OrderID: "o-1", TS: time.Now()})
+		}
+	}()
+	deadline := time.After(5 * time.Second)
+	for got := 0; got < n; got++ {
+		select {
+		case <-sub:
+		case <-deadline:
+			t.Fatalf("local subscriber got %d of %d events with the bus stalled", got, n)
+		}
+	}
+	close(bus.release)
+	until := time.Now().Add(5 * time.Second)
+	for testutil.ToFloat64(droppedCtr) == dropped {
+		if time.Now().After(until) {
+			t.Fatal("drops were not counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRedisBus(t *testing.T) {
+	mr := miniredis.RunT(t)
+	testBus(t, func() Bus { return NewRedis(mr.Addr(), "", "orderpulse:cluster") })
+}
+
+func TestNATSBus(t *testing.T) {
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, NoLog: true, NoSigs: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server did not start")
+	}
+	t.Cleanup(s.Shutdown)
+	testBus(t, func() Bus {
+		n, err := NewNATS(s.ClientURL(), "orderpulse.cluster")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	})
+}
+
+// testBus bridges two hubs over separate connections to a real broker.
+// Subscriptions start asynchronously, so it publishes until the first
+// event crosses and then checks that exactly one copy of the next one does.
+func testBus(t *testing.T, dial func() Bus) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	busA, busB := dial(), dial()
+	t.Cleanup(func() { _ = busA.Close(); _ = busB.Close() })
+	a := startNode(t, ctx, "a", busA)
+	b := startNode(t, ctx, "b", busB)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for crossed := false; !crossed; {
+		if time.Now().After(deadline) {
+			t.Fatal("bus never delivered")
+		}
+		publish(t, a.hub, "warmup")
+		<-a.got
+		select {
+		case <-b.got:
+			crossed = true
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	// Drain warmups still in flight.
+	for drained := false; !drained; {
+		select {
+		case <-b.got:
+		case <-time.After(200 * time.Millisecond):
+			drained = true
+		}
+	}
+
+	publish(t, a.hub, "e1")
+	a.expect(t, "a", "e1")
+	b.expect(t, "b", "e1")
+}
+
+func waitSubscribers(t *testing.T, m *Memory, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.mu.RLock()
+		got := len(m.subs)
+		m.mu.RUnlock()
+		if got >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d bus subscribers, want %d", got, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
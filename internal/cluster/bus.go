@@ -0,0 +1,132 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+)
+
+// Bus carries serialised events between instances. Delivery is best effort:
+// an instance that is down misses what was sent meanwhile.
+type Bus interface {
+	Publish(ctx context.Context, data []byte) error
+	// Subscribe calls fn for every message, including this instance's own,
+	// until ctx is done or the subscription fails.
+	Subscribe(ctx context.Context, fn func([]byte)) error
+	Close() error
+}
+
+// Redis is a Redis pub/sub bus on one channel.
+type Redis struct {
+	client  *redis.Client
+	channel string
+}
+
+func NewRedis(addr, password, channel string) *Redis {
+	return &Redis{client: redis.NewClient(&redis.Options{Addr: addr, Password: password}), channel: channel}
+}
+
+func (r *Redis) Publish(ctx context.Context, data []byte) error {
+	return r.client.Publish(ctx, r.channel, data).Err()
+}
+
+func (r *Redis) Subscribe(ctx context.Context, fn func([]byte)) error {
+	ps := r.client.Subscribe(ctx, r.channel)
+	defer ps.Close()
+	if _, err := ps.Receive(ctx); err != nil {
+		return err
+	}
+	ch := ps.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case m, ok := <-ch:
+			if !ok {
+				return redis.ErrClosed
+			}
+			fn([]byte(m.Payload))
+		}
+	}
+}
+
+func (r *Redis) Close() error { return r.client.Close() }
+
+// NATS is a core NATS bus on one subject.
+type NATS struct {
+	nc      *nats.Conn
+	subject string
+}
+
+func NewNATS(url, subject string) (*NATS, error) {
+	nc, err := nats.Connect(url,
+		nats.Name("orderpulse-api cluster"),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2*time.Second),
+		nats.RetryOnFailedConnect(true),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Warn().Err(err).Msg("cluster bus disconnected")
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &NATS{nc: nc, subject: subject}, nil
+}
+
+func (n *NATS) Publish(_ context.Context, data []byte) error {
+	return n.nc.Publish(n.subject, data)
+}
+
+func (n *NATS) Subscribe(ctx context.Context, fn func([]byte)) error {
+	sub, err := n.nc.Subscribe(n.subject, func(m *nats.Msg) { fn(m.Data) })
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (n *NATS) Close() error {
+	n.nc.Close()
+	return nil
+}
+
+// Memory is an in-process bus shared by every bridge attached to it; it
+// stands in for a real broker when running several hubs in one process.
+type Memory struct {
+	mu   sync.RWMutex
+	next int
+	subs map[int]func([]byte)
+}
+
+func NewMemory() *Memory { return &Memory{subs: map[int]func([]byte){}} }
+
+func (m *Memory) Publish(_ context.Context, data []byte) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, fn := range m.subs {
+		fn(append([]byte(nil), data...))
+	}
+	return nil
+}
+
+func (m *Memory) Subscribe(ctx context.Context, fn func([]byte)) error {
+	m.mu.Lock()
+	id := m.next
+	m.next++
+	m.subs[id] = fn
+	m.mu.Unlock()
+	<-ctx.Done()
+	m.mu.Lock()
+	delete(m.subs, id)
+	m.mu.Unlock()
+	return ctx.Err()
+}
+
+func (m *Memory) Close() error { return nil }
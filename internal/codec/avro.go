@@ -0,0 +1,81 @@
+package codec
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hamba/avro/v2"
+)
+
+type avroDecoder struct {
+	reg *Registry
+
+	mu      sync.Mutex
+	schemas map[int]avro.Schema
+}
+
+func NewAvro(reg *Registry) Decoder {
+	return &avroDecoder{reg: reg, schemas: map[int]avro.Schema{}}
+}
+
+func (d *avroDecoder) Decode(ctx context.Context, data []byte) (map[string]any, error) {
+	id, payload, err := splitWire(data)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := d.schema(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	doc := map[string]any{}
+	if err := avro.Unmarshal(sc, payload, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (d *avroDecoder) schema(ctx context.Context, id int) (avro.Schema, error) {
+	d.mu.Lock()
+	s, ok := d.schemas[id]
+	d.mu.Unlock()
+	if ok {
+		return s, nil
+	}
+	raw, err := d.reg.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	cache := &avro.SchemaCache{}
+	if err := d.parseRefs(ctx, raw.References, cache, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	s, err = avro.ParseWithCache(raw.Schema, "", cache)
+	if err != nil {
+		return nil, fmt.Errorf("parse schema %d: %w", id, err)
+	}
+	d.mu.Lock()
+	d.schemas[id] = s
+	d.mu.Unlock()
+	return s, nil
+}
+
+func (d *avroDecoder) parseRefs(ctx context.Context, refs []Reference, cache *avro.SchemaCache, seen map[string]bool) error {
+	for _, ref := range refs {
+		if seen[ref.Name] {
+			continue
+		}
+		seen[ref.Name] = true
+		sc, err := d.reg.SchemaBySubject(ctx, ref.Subject, ref.Version)
+		if err != nil {
+			return err
+		}
+		if err := d.parseRefs(ctx, sc.References, cache, seen); err != nil {
+			return err
+		}
+		if _, err := avro.ParseWithCache(sc.Schema, "", cache); err != nil {
+			return fmt.Errorf("parse reference %s: %w", ref.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+)
+
+type Format string
+
+const (
+	Auto     Format = "auto"
+	JSON     Format = "json"
+	Protobuf Format = "protobuf"
+	Avro     Format = "avro"
+)
+
+var ErrUnknownFormat = errors.New("codec: unknown format")
+
+// Decoder turns a raw message body into a generic document; mapping it onto
+// models.OrderEvent is left to the caller.
+type Decoder interface {
+	Decode(ctx context.Context, data []byte) (map[string]any, error)
+}
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(strings.TrimSpace(s))); f {
+	case "":
+		return Auto, nil
+	case Auto, JSON, Protobuf, Avro:
+		return f, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownFormat, s)
+	}
+}
+
+func FormatFromContentType(ct string) Format {
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return Auto
+	}
+	switch mt {
+	case "application/json", "text/json", "application/x-ndjson":
+		return JSON
+	case "application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf":
+		return Protobuf
+	case "avro/binary", "application/avro", "application/vnd.apache.avro+binary":
+		return Avro
+	}
+	switch {
+	case strings.HasSuffix(mt, "+json"):
+		return JSON
+	case strings.HasSuffix(mt, "+protobuf"):
+		return Protobuf
+	case strings.HasSuffix(mt, "+avro"):
+		return Avro
+	}
+	return Auto
+}
+
+type Set struct {
+	reg      *Registry
+	json     Decoder
+	protobuf Decoder
+	avro     Decoder
+}
+
+// NewSet builds the decoders shared by all inputs. reg may be nil, in which
+// case only JSON is available.
+func NewSet(reg *Registry) *Set {
+	s := &Set{reg: reg, json: jsonDecoder{}}
+	if reg != nil {
+		s.protobuf = NewProtobuf(reg)
+		s.avro = NewAvro(reg)
+	}
+	return s
+}
+
+// For picks a decoder: an explicit format wins, then the content type, then
+// the Confluent wire-format magic byte (resolved through the registry).
+func (s *Set) For(ctx context.Context, f Format, contentType string, data []byte) (Decoder, error) {
+	if f == Auto || f == "" {
+		f = FormatFromContentType(contentType)
+	}
+	if f == Auto {
+		f = JSON
+		if s.reg != nil {
+			if id, ok := schemaID(data); ok {
+				sc, err := s.reg.SchemaByID(ctx, id)
+				if err != nil {
+					return nil, err
+				}
+				f = sc.Format()
+			}
+		}
+	}
+	var d Decoder
+	switch f {
+	case JSON:
+		d = s.json
+	case Protobuf:
+		d = s.protobuf
+	case Avro:
+		d = s.avro
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownFormat, f)
+	}
+	if d == nil {
+		return nil, fmt.Errorf("codec: %s requires a schema registry", f)
+	}
+	return d, nil
+}
+
+type jsonDecoder struct{}
+
+func (jsonDecoder) Decode(_ context.Context, data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	doc := map[string]any{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+const magicByte = 0
+
+func schemaID(data []byte) (int, bool) {
+	if len(data) < 5 || data[0] != magicByte {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint32(data[1:5])), true
+}
+
+func splitWire(data []byte) (int, []byte, error) {
+	id, ok := schemaID(data)
+	if !ok {
+		return 0, nil, errors.New("codec: missing schema registry header")
+	}
+	return id, data[5:], nil
+}
@@ -0,0 +1,227 @@
+package codec
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// fakeRegistry serves schemas the way the Confluent REST API does and
+// counts the requests it gets.
+type fakeRegistry struct {
+	mu       sync.Mutex
+	ids      map[int]Schema
+	subjects map[string]Schema // "subject/version"
+	hits     map[string]int
+}
+
+func newFakeRegistry(t *testing.T) (*fakeRegistry, *Registry) {
+	f := &fakeRegistry{ids: map[int]Schema{}, subjects: map[string]Schema{}, hits: map[string]int{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, NewRegistry(srv.URL+"/", "", "")
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.hits[r.URL.Path]++
+	var (
+		sc Schema
+		ok bool
+	)
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/schemas/ids/"):
+		var id int
+		_ = json.Unmarshal([]byte(strings.TrimPrefix(r.URL.Path, "/schemas/ids/")), &id)
+		sc, ok = f.ids[id]
+	case strings.HasPrefix(r.URL.Path, "/subjects/"):
+		p := strings.TrimPrefix(r.URL.Path, "/subjects/")
+		sc, ok = f.subjects[strings.Replace(p, "/versions/", "/", 1)]
+	}
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error_code": 40403, "message": "Schema not found"})
+		return
+	}
+	_ = json.NewEncoder(w).Encode(sc)
+}
+
+func (f *fakeRegistry) hitCount(path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.hits[path]
+}
+
+func wire(id int, payload []byte) []byte {
+	b := []byte{magicByte, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(b[1:], uint32(id))
+	return append(b, payload...)
+}
+
+const orderAvro = `{"type": "record", "name": "Order", "fields": [
+	{"name": "id", "type": "string"},
+	{"name": "orderId", "type": "string"},
+	{"name": "amount", "type": "long"},
+	{"name": "ts", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+	{"name": "status", "type": ["null", "string"], "default": null}
+]}`
+
+func TestAvroThroughRegistry(t *testing.T) {
+	f, reg := newFakeRegistry(t)
+	f.ids[7] = Schema{Schema: orderAvro}
+
+	ts := time.UnixMilli(1_700_000_000_123).UTC()
+	payload, err := avro.Marshal(avro.MustParse(orderAvro), map[string]any{
+		"id": "e1", "orderId": "o1", "amount": int64(250), "ts": ts, "status": "paid",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := NewSet(reg)
+	for range 3 {
+		d, err := set.For(context.Background(), Auto, "", wire(7, payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := d.Decode(context.Background(), wire(7, payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev, err := ToEvent(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.ID != "e1" || ev.OrderID != "o1" || ev.Amount != 250 || ev.Status != "paid" || !ev.TS.Equal(ts) {
+			t.Fatalf("decoded %+v", ev)
+		}
+	}
+	if n := f.hitCount("/schemas/ids/7"); n != 1 {
+		t.Fatalf("registry fetched schema 7 %d times, want 1", n)
+	}
+}
+
+func TestAvroReferences(t *testing.T) {
+	f, reg := newFakeRegistry(t)
+	f.subjects["money/3"] = Schema{Schema: `{"type": "record", "name": "Money", "fields": [{"name": "cents", "type": "long"}]}`}
+	f.ids[8] = Schema{
+		Schema: `{"type": "record", "name": "Order", "fields": [
+			{"name": "id", "type": "string"}, {"name": "total", "type": "Money"}]}`,
+		References: []Reference{{Name: "Money", Subject: "money", Version: 3}},
+	}
+	full := avro.MustParse(`{"type": "record", "name": "Order", "fields": [{"name": "id", "type": "string"},
+		{"name": "total", "type": {"type": "record", "name": "Money", "fields": [{"name": "cents", "type": "long"}]}}]}`)
+	payload, err := avro.Marshal(full, map[string]any{"id": "e2", "total": map[string]any{"cents": int64(99)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := NewAvro(reg).Decode(context.Background(), wire(8, payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, _ := doc["total"].(map[string]any)
+	if doc["id"] != "e2" || total["cents"] != int64(99) {
+		t.Fatalf("decoded %v", doc)
+	}
+}
+
+func TestProtobufThroughRegistry(t *testing.T) {
+	f, reg := newFakeRegistry(t)
+	f.ids[9] = Schema{SchemaType: "PROTOBUF", Schema: `syntax = "proto3";
+message Ignored { string x = 1; }
+message Order { string id = 1; string order_id = 2; int64 amount = 3; string status = 4; }`}
+
+	var msg []byte
+	msg = protowire.AppendTag(msg, 1, protowire.BytesType)
+	msg = protowire.AppendString(msg, "e3")
+	msg = protowire.AppendTag(msg, 2, protowire.BytesType)
+	msg = protowire.AppendString(msg, "o3")
+	msg = protowire.AppendTag(msg, 3, protowire.VarintType)
+	msg = protowire.AppendVarint(msg, 4200)
+	msg = protowire.AppendTag(msg, 4, protowire.BytesType)
+	msg = protowire.AppendString(msg, "shipped")
+	// Message index path [1]: one entry, the second message in the file.
+	payload := append(binary.AppendVarint(binary.AppendVarint(nil, 1), 1), msg...)
+
+	set := NewSet(reg)
+	d, err := set.For(context.Background(), Auto, "", wire(9, payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := d.Decode(context.Background(), wire(9, payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, err := ToEvent(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.ID != "e3" || ev.OrderID != "o3" || ev.Amount != 4200 || ev.Status != "shipped" {
+		t.Fatalf("decoded %+v", ev)
+	}
+	if n := f.hitCount("/schemas/ids/9"); n != 1 {
+		t.Fatalf("registry fetched schema 9 %d times, want 1", n)
+	}
+}
+
+func TestRegistrySubjectCache(t *testing.T) {
+	f, reg := newFakeRegistry(t)
+	f.subjects["orders-value/2"] = Schema{ID: 2, Schema: `"string"`}
+	f.subjects["orders-value/latest"] = Schema{ID: 3, Schema: `"long"`}
+	ctx := context.Background()
+
+	for range 2 {
+		if sc, err := reg.SchemaBySubject(ctx, "orders-value", 2); err != nil || sc.ID != 2 {
+			t.Fatalf("version 2: %+v, %v", sc, err)
+		}
+		if sc, err := reg.SchemaBySubject(ctx, "orders-value", 0); err != nil || sc.ID != 3 {
+			t.Fatalf("latest: %+v, %v", sc, err)
+		}
+	}
+	// Pinned versions are immutable and cached; latest can move, so it is not.
+	if n := f.hitCount("/subjects/orders-value/versions/2"); n != 1 {
+		t.Fatalf("version 2 fetched %d times, want 1", n)
+	}
+	if n := f.hitCount("/subjects/orders-value/versions/latest"); n != 2 {
+		t.Fatalf("latest fetched %d times, want 2", n)
+	}
+}
+
+func TestRegistryErrors(t *testing.T) {
+	_, reg := newFakeRegistry(t)
+	_, err := NewSet(reg).For(context.Background(), Auto, "", wire(404, []byte{1}))
+	if err == nil || !strings.Contains(err.Error(), "Schema not found") {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := NewSet(nil).For(context.Background(), Avro, "", nil); err == nil {
+		t.Fatal("avro without a registry should fail")
+	}
+	if d, err := NewSet(nil).For(context.Background(), Auto, "application/json", []byte(`{}`)); err != nil || d == nil {
+		t.Fatalf("json without a registry: %v", err)
+	}
+}
+
+func TestProtobufMalformedMessageIndexes(t *testing.T) {
+	f, reg := newFakeRegistry(t)
+	f.ids[1] = Schema{SchemaType: "PROTOBUF", Schema: `syntax = "proto3"; message Order { string id = 1; }`}
+	d := NewProtobuf(reg)
+	for name, rest := range map[string][]byte{
+		"negative count": {0x01, 0x02},
+		"huge count":     binary.AppendVarint(nil, 1<<40),
+		"truncated":      {0x04, 0x02},
+		"missing":        {},
+	} {
+		if _, err := d.Decode(context.Background(), wire(1, rest)); err == nil {
+			t.Errorf("%s: decoded a malformed header", name)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+// ToEvent maps a decoded document whose keys follow models.OrderEvent's JSON
+// names onto an event, coercing the numeric and time encodings that the
+// protobuf and avro decoders produce.
+func ToEvent(doc map[string]any) (models.OrderEvent, error) {
+	ev := models.OrderEvent{
+		ID:      String(doc["id"]),
+		OrderID: String(doc["orderId"]),
+		Type:    String(doc["type"]),
+		Status:  String(doc["status"]),
+		Channel: String(doc["channel"]),
+	}
+	if v, ok := doc["amount"]; ok && v != nil {
+		n, err := Int(v)
+		if err != nil {
+			return ev, fmt.Errorf("amount: %w", err)
+		}
+		ev.Amount = n
+	}
+	if v, ok := doc["ts"]; ok && v != nil {
+		t, err := Time(v)
+		if err != nil {
+			return ev, fmt.Errorf("ts: %w", err)
+		}
+		ev.TS = t
+	}
+	return ev, nil
+}
+
+// unwrap strips avro's {"type": value} union encoding.
+func unwrap(v any) any {
+	if m, ok := v.(map[string]any); ok && len(m) == 1 {
+		for _, x := range m {
+			return x
+		}
+	}
+	return v
+}
+
+func String(v any) string {
+	switch x := unwrap(v).(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case []byte:
+		return string(x)
+	case json.Number:
+		return x.String()
+	case fmt.Stringer:
+		return x.String()
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+func Int(v any) (int, error) {
+	switch x := unwrap(v).(type) {
+	case int:
+		return x, nil
+	case int32:
+		return int(x), nil
+	case int64:
+		return int(x), nil
+	case float32:
+		return int(math.Round(float64(x))), nil
+	case float64:
+		return int(math.Round(x)), nil
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return int(i), nil
+		}
+		f, err := x.Float64()
+		return int(math.Round(f)), err
+	case string:
+		if i, err := strconv.ParseInt(x, 10, 64); err == nil {
+			return int(i), nil
+		}
+		f, err := strconv.ParseFloat(x, 64)
+		return int(math.Round(f)), err
+	default:
+		return 0, fmt.Errorf("not a number: %T", x)
+	}
+}
+
+// Time accepts RFC 3339 strings, time.Time values and unix epochs; numbers
+// above 1e12 are taken as milliseconds.
+func Time(v any) (time.Time, error) {
+	switch x := unwrap(v).(type) {
+	case time.Time:
+		return x.UTC(), nil
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, x); err == nil {
+			return t, nil
+		}
+		if _, err := strconv.ParseFloat(x, 64); err == nil {
+			return Time(json.Number(x))
+		}
+		return time.Time{}, fmt.Errorf("bad time %q", x)
+	default:
+		n, err := Int(x)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if n > 1e12 {
+			return time.UnixMilli(int64(n)).UTC(), nil
+		}
+		return time.Unix(int64(n), 0).UTC(), nil
+	}
+}
+
+func Float(v any) (float64, error) {
+	switch x := unwrap(v).(type) {
+	case float64:
+		return x, nil
+	case float32:
+		return float64(x), nil
+	case json.Number:
+		return x.Float64()
+	case string:
+		return strconv.ParseFloat(x, 64)
+	default:
+		n, err := Int(x)
+		return float64(n), err
+	}
+}
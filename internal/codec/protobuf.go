@@ -0,0 +1,147 @@
+package codec
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/bufbuild/protocompile"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+type protobufDecoder struct {
+	reg *Registry
+
+	mu    sync.Mutex
+	files map[int]protoreflect.FileDescriptor
+}
+
+func NewProtobuf(reg *Registry) Decoder {
+	return &protobufDecoder{reg: reg, files: map[int]protoreflect.FileDescriptor{}}
+}
+
+func (d *protobufDecoder) Decode(ctx context.Context, data []byte) (map[string]any, error) {
+	id, rest, err := splitWire(data)
+	if err != nil {
+		return nil, err
+	}
+	idx, payload, err := messageIndexes(rest)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := d.file(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	md, err := messageAt(fd, idx)
+	if err != nil {
+		return nil, err
+	}
+	msg := dynamicpb.NewMessage(md)
+	if err := proto.Unmarshal(payload, msg); err != nil {
+		return nil, err
+	}
+	b, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return jsonDecoder{}.Decode(ctx, b)
+}
+
+func (d *protobufDecoder) file(ctx context.Context, id int) (protoreflect.FileDescriptor, error) {
+	d.mu.Lock()
+	fd, ok := d.files[id]
+	d.mu.Unlock()
+	if ok {
+		return fd, nil
+	}
+	sc, err := d.reg.SchemaByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	name := "registry/" + strconv.Itoa(id) + ".proto"
+	srcs := map[string]string{name: sc.Schema}
+	if err := d.collect(ctx, sc.References, srcs); err != nil {
+		return nil, err
+	}
+	c := protocompile.Compiler{
+		Resolver: protocompile.WithStandardImports(&protocompile.SourceResolver{
+			Accessor: protocompile.SourceAccessorFromMap(srcs),
+		}),
+	}
+	files, err := c.Compile(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("compile schema %d: %w", id, err)
+	}
+	fd = files[0]
+	d.mu.Lock()
+	d.files[id] = fd
+	d.mu.Unlock()
+	return fd, nil
+}
+
+func (d *protobufDecoder) collect(ctx context.Context, refs []Reference, srcs map[string]string) error {
+	for _, ref := range refs {
+		if _, ok := srcs[ref.Name]; ok {
+			continue
+		}
+		sc, err := d.reg.SchemaBySubject(ctx, ref.Subject, ref.Version)
+		if err != nil {
+			return err
+		}
+		srcs[ref.Name] = sc.Schema
+		if err := d.collect(ctx, sc.References, srcs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageIndexes reads the Confluent message-index path that follows the
+// schema ID; a single zero byte is shorthand for the first message.
+func messageIndexes(b []byte) ([]int, []byte, error) {
+	n, sz := binary.Varint(b)
+	if sz <= 0 {
+		return nil, nil, errors.New("protobuf: bad message index count")
+	}
+	b = b[sz:]
+	if n == 0 {
+		return []int{0}, b, nil
+	}
+	// Each index takes at least a byte, which bounds a sane count.
+	if n < 0 || n > int64(len(b)) {
+		return nil, nil, fmt.Errorf("protobuf: bad message index count %d", n)
+	}
+	idx := make([]int, 0, n)
+	for i := int64(0); i < n; i++ {
+		v, sz := binary.Varint(b)
+		if sz <= 0 {
+			return nil, nil, errors.New("protobuf: bad message index")
+		}
+		idx = append(idx, int(v))
+		b = b[sz:]
+	}
+	return idx, b, nil
+}
+
+func messageAt(fd protoreflect.FileDescriptor, idx []int) (protoreflect.MessageDescriptor, error) {
+	msgs := fd.Messages()
+	var md protoreflect.MessageDescriptor
+	for _, i := range idx {
+		if i < 0 || i >= msgs.Len() {
+			return nil, fmt.Errorf("protobuf: message index %v out of range", idx)
+		}
+		md = msgs.Get(i)
+		msgs = md.Messages()
+	}
+	if md == nil {
+		return nil, errors.New("protobuf: schema has no messages")
+	}
+	return md, nil
+}
@@ -0,0 +1,129 @@
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry is a minimal client for the Confluent schema registry REST API.
+type Registry struct {
+	base   string
+	user   string
+	pass   string
+	client *http.Client
+
+	mu       sync.Mutex
+	byID     map[int]*Schema
+	bySubVer map[string]*Schema
+}
+
+type Schema struct {
+	ID         int         `json:"id"`
+	Subject    string      `json:"subject,omitempty"`
+	Version    int         `json:"version,omitempty"`
+	SchemaType string      `json:"schemaType,omitempty"`
+	Schema     string      `json:"schema"`
+	References []Reference `json:"references,omitempty"`
+}
+
+type Reference struct {
+	Name    string `json:"name"`
+	Subject string `json:"subject"`
+	Version int    `json:"version"`
+}
+
+func (s *Schema) Format() Format {
+	switch strings.ToUpper(s.SchemaType) {
+	case "PROTOBUF":
+		return Protobuf
+	case "JSON":
+		return JSON
+	default:
+		return Avro
+	}
+}
+
+func NewRegistry(baseURL, user, pass string) *Registry {
+	return &Registry{
+		base:     strings.TrimRight(baseURL, "/"),
+		user:     user,
+		pass:     pass,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		byID:     map[int]*Schema{},
+		bySubVer: map[string]*Schema{},
+	}
+}
+
+func (r *Registry) SchemaByID(ctx context.Context, id int) (*Schema, error) {
+	r.mu.Lock()
+	sc, ok := r.byID[id]
+	r.mu.Unlock()
+	if ok {
+		return sc, nil
+	}
+	sc = &Schema{}
+	if err := r.get(ctx, "/schemas/ids/"+strconv.Itoa(id), sc); err != nil {
+		return nil, err
+	}
+	sc.ID = id
+	r.mu.Lock()
+	r.byID[id] = sc
+	r.mu.Unlock()
+	return sc, nil
+}
+
+func (r *Registry) SchemaBySubject(ctx context.Context, subject string, version int) (*Schema, error) {
+	key := subject + "/" + strconv.Itoa(version)
+	r.mu.Lock()
+	sc, ok := r.bySubVer[key]
+	r.mu.Unlock()
+	if ok {
+		return sc, nil
+	}
+	ver := "latest"
+	if version > 0 {
+		ver = strconv.Itoa(version)
+	}
+	sc = &Schema{}
+	if err := r.get(ctx, "/subjects/"+url.PathEscape(subject)+"/versions/"+ver, sc); err != nil {
+		return nil, err
+	}
+	if version > 0 {
+		r.mu.Lock()
+		r.bySubVer[key] = sc
+		r.mu.Unlock()
+	}
+	return sc, nil
+}
+
+func (r *Registry) get(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.base+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.schemaregistry.v1+json, application/json")
+	if r.user != "" {
+		req.SetBasicAuth(r.user, r.pass)
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var e struct {
+			Code    int    `json:"error_code"`
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(res.Body).Decode(&e)
+		return fmt.Errorf("schema registry %s: %d %s", path, res.StatusCode, e.Message)
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
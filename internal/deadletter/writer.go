@@ -0,0 +1,70 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var dlqCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "deadletter_messages_total",
+	Help: "messages routed to the dead-letter log",
+}, []string{"source", "stage"})
+
+func init() { prometheus.MustRegister(dlqCtr) }
+
+type Record struct {
+	TS          time.Time `json:"ts"`
+	Source      string    `json:"source"`
+	Stage       string    `json:"stage"`
+	Error       string    `json:"error"`
+	ContentType string    `json:"contentType,omitempty"`
+	Payload     string    `json:"payload,omitempty"`
+	PayloadB64  []byte    `json:"payloadBase64,omitempty"`
+}
+
+// Writer appends rejected messages to an NDJSON file so they can be
+// inspected and replayed later.
+type Writer struct {
+	path string
+	mu   sync.Mutex
+}
+
+func New(path string) (*Writer, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return &Writer{path: path}, nil
+}
+
+func (w *Writer) Write(source, stage string, cause error, contentType string, payload []byte) error {
+	dlqCtr.WithLabelValues(source, stage).Inc()
+	if w == nil {
+		return nil
+	}
+	rec := Record{TS: time.Now().UTC(), Source: source, Stage: stage, Error: cause.Error(), ContentType: contentType}
+	if utf8.Valid(payload) {
+		rec.Payload = string(payload)
+	} else {
+		rec.PayloadB64 = payload
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,207 @@
+package dedup
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/input"
+	"orderpulse-api/internal/models"
+)
+
+var (
+	dupCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ingest_duplicates_total",
+		Help: "events dropped because their ID was already published",
+	}, []string{"source"})
+	sizeGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ingest_dedup_window_size",
+		Help: "event IDs currently held in the dedup window",
+	})
+)
+
+func init() { prometheus.MustRegister(dupCtr, sizeGauge) }
+
+type item struct {
+	ID string    `json:"id"`
+	At time.Time `json:"at"`
+}
+
+// Window remembers event IDs for ttl, holding at most max of them; the
+// oldest are evicted first. A ttl <= 0 keeps IDs until max evicts them.
+type Window struct {
+	ttl  time.Duration
+	max  int
+	path string
+
+	mu    sync.Mutex
+	order *list.List
+	ids   map[string]*list.Element
+}
+
+// New creates a window; when path is set, the window is loaded from and
+// saved to that file so a restart does not re-admit recent duplicates.
+func New(ttl time.Duration, max int, path string) (*Window, error) {
+	w := &Window{ttl: ttl, max: max, path: path, order: list.New(), ids: map[string]*list.Element{}}
+	if path == "" {
+		return w, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return w, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	now := time.Now()
+	for sc.Scan() {
+		var it item
+		if json.Unmarshal(sc.Bytes(), &it) == nil && !w.expired(it, now) {
+			w.insert(it)
+		}
+	}
+	return w, sc.Err()
+}
+
+// Admit records id and reports whether it was new.
+func (w *Window) Admit(id string) bool {
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.expire(now)
+	if _, ok := w.ids[id]; ok {
+		return false
+	}
+	w.insert(item{ID: id, At: now})
+	return true
+}
+
+// Forget removes id again, used when the publish it guarded failed.
+func (w *Window) Forget(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if el, ok := w.ids[id]; ok {
+		w.order.Remove(el)
+		delete(w.ids, id)
+		sizeGauge.Set(float64(len(w.ids)))
+	}
+}
+
+func (w *Window) insert(it item) {
+	w.ids[it.ID] = w.order.PushBack(it)
+	for w.max > 0 && len(w.ids) > w.max {
+		w.removeFront()
+	}
+	sizeGauge.Set(float64(len(w.ids)))
+}
+
+func (w *Window) expire(now time.Time) {
+	for w.order.Len() > 0 && w.expired(w.order.Front().Value.(item), now) {
+		w.removeFront()
+	}
+	sizeGauge.Set(float64(len(w.ids)))
+}
+
+func (w *Window) expired(it item, now time.Time) bool {
+	return w.ttl > 0 && now.Sub(it.At) >= w.ttl
+}
+
+func (w *Window) removeFront() {
+	el := w.order.Front()
+	w.order.Remove(el)
+	delete(w.ids, el.Value.(item).ID)
+}
+
+func (w *Window) Save() error {
+	if w.path == "" {
+		return nil
+	}
+	tmp := w.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	w.mu.Lock()
+	for el := w.order.Front(); el != nil; el = el.Next() {
+		_ = enc.Encode(el.Value.(item))
+	}
+	w.mu.Unlock()
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.path)
+}
+
+// Persist saves the window every interval until ctx is done; a no-op
+// without a path.
+func (w *Window) Persist(ctx context.Context, every time.Duration) {
+	if w.path == "" {
+		return
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := w.Save(); err != nil {
+				log.Warn().Err(err).Str("path", w.path).Msg("dedup save")
+			}
+		}
+	}
+}
+
+// Middleware drops events whose ID is already in the window, except for the
+// sources listed in skip.
+func (w *Window) Middleware(skip ...string) input.Middleware {
+	off := map[string]bool{}
+	for _, s := range skip {
+		off[s] = true
+	}
+	return func(source string, next input.Publisher) input.Publisher {
+		if off[source] {
+			return next
+		}
+		return publisher{w: w, source: source, next: next}
+	}
+}
+
+type publisher struct {
+	w      *Window
+	source string
+	next   input.Publisher
+}
+
+func (p publisher) Publish(ev models.OrderEvent) error {
+	if ev.ID == "" {
+		return p.next.Publish(ev)
+	}
+	if !p.w.Admit(ev.ID) {
+		dupCtr.WithLabelValues(p.source).Inc()
+		return nil
+	}
+	if err := p.next.Publish(ev); err != nil {
+		p.w.Forget(ev.ID)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package dedup
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+func admitAll(w *Window, ids ...string) []bool {
+	out := make([]bool, len(ids))
+	for i, id := range ids {
+		out[i] = w.Admit(id)
+	}
+	return out
+}
+
+func TestAdmit(t *testing.T) {
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		max  int
+		ids  []string
+		want []bool
+	}{
+		{"duplicate", time.Minute, 100, []string{"a", "b", "a"}, []bool{true, true, false}},
+		{"zero ttl never expires", 0, 100, []string{"a", "a", "b", "a"}, []bool{true, false, true, false}},
+		{"negative ttl never expires", -time.Second, 100, []string{"a", "a"}, []bool{true, false}},
+		{"max evicts oldest", time.Minute, 2, []string{"a", "b", "c", "a", "c"}, []bool{true, true, true, true, false}},
+		{"zero ttl still bounded by max", 0, 1, []string{"a", "b", "a"}, []bool{true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := New(tt.ttl, tt.max, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := admitAll(w, tt.ids...)
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Admit(%s) #%d = %v, want %v", tt.ids[i], i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTTLExpiry(t *testing.T) {
+	w, _ := New(50*time.Millisecond, 100, "")
+	w.Admit("a")
+	if w.Admit("a") {
+		t.Fatal("admitted a duplicate within the ttl")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if !w.Admit("a") {
+		t.Fatal("refused an id after its ttl")
+	}
+}
+
+func TestReloadFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dedup", "window.ndjson")
+	w, err := New(100*time.Millisecond, 100, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Admit("old")
+	time.Sleep(120 * time.Millisecond)
+	w.Admit("new")
+	if err := w.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := New(100*time.Millisecond, 100, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Admit("new") {
+		t.Fatal("reloaded window admitted a saved id")
+	}
+	if !r.Admit("old") {
+		t.Fatal("reloaded window kept an expired id")
+	}
+}
+
+type failing struct{ err error }
+
+func (f failing) Publish(models.OrderEvent) error { return f.err }
+
+func TestMiddlewareForgetsFailedPublish(t *testing.T) {
+	w, _ := New(time.Minute, 100, "")
+	ev := models.OrderEvent{ID: "e1"}
+	boom := errors.New("log unavailable")
+	if err := w.Middleware()("http", failing{boom}).Publish(ev); !errors.Is(err, boom) {
+		t.Fatalf("err = %v", err)
+	}
+	// The failed publish must not make the retry look like a duplicate.
+	if !w.Admit("e1") {
+		t.Fatal("failed publish left its id in the window")
+	}
+	if pub := w.Middleware("mock")("mock", failing{}); pub != (failing{}) {
+		t.Fatal("skipped source was wrapped")
+	}
+}
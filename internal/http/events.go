@@ -0,0 +1,123 @@
+package httpx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"orderpulse-api/internal/input"
+	"orderpulse-api/internal/models"
+)
+
+type ingestReject struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type ingestResult struct {
+	Accepted int            `json:"accepted"`
+	IDs      []string       `json:"ids"`
+	Rejected []ingestReject `json:"rejected,omitempty"`
+}
+
+func validateEvent(ev *models.OrderEvent) error {
+	switch {
+	case ev.OrderID == "":
+		return errors.New("orderId: required")
+	case ev.Type == "":
+		return errors.New("type: required")
+	case ev.Status == "":
+		return errors.New("status: required")
+	case ev.Amount < 0:
+		return errors.New("amount: must not be negative")
+	case !models.ValidChannel(ev.Channel):
+		return errors.New("channel: invalid name")
+	}
+	if ev.ID == "" {
+		ev.ID = uuid.NewString()
+	}
+	return nil
+}
+
+// Events accepts a single JSON event or an NDJSON batch
+// (Content-Type: application/x-ndjson) and publishes every valid one.
+func Events(pub input.Publisher, dec *input.Decoder, idemTTL time.Duration) http.HandlerFunc {
+	idem := newIdempotency(idemTTL, 10000)
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			WriteError(w, http.StatusRequestEntityTooLarge, "too_large", "body too large")
+			return
+		}
+
+		key := r.Header.Get("Idempotency-Key")
+		if key != "" {
+			sub, _ := r.Context().Value(CtxSub).(string)
+			key = sub + "\x00" + key
+			switch res, e := idem.begin(key, body); res {
+			case idemReplay:
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(e.status)
+				_, _ = w.Write(e.body)
+				return
+			case idemInFlight:
+				WriteError(w, http.StatusConflict, "in_flight", "request with this Idempotency-Key is in progress")
+				return
+			case idemMismatch:
+				WriteError(w, http.StatusUnprocessableEntity, "idempotency_mismatch", "Idempotency-Key reused with a different body")
+				return
+			}
+		}
+
+		mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		lines := [][]byte{body}
+		if mt == "application/x-ndjson" {
+			lines = lines[:0]
+			sc := bufio.NewScanner(bytes.NewReader(body))
+			sc.Buffer(make([]byte, 64<<10), len(body)+1)
+			for sc.Scan() {
+				lines = append(lines, bytes.Clone(sc.Bytes()))
+			}
+		}
+
+		res := ingestResult{IDs: []string{}}
+		for i, line := range lines {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			ev, err := dec.Decode(r.Context(), "application/json", line)
+			if err == nil {
+				err = validateEvent(&ev)
+			}
+			if err == nil {
+				err = pub.Publish(ev)
+			}
+			if err != nil {
+				res.Rejected = append(res.Rejected, ingestReject{Line: i + 1, Error: err.Error()})
+				continue
+			}
+			res.Accepted++
+			res.IDs = append(res.IDs, ev.ID)
+		}
+
+		status := http.StatusAccepted
+		if res.Accepted == 0 {
+			status = http.StatusBadRequest
+		}
+		b, _ := json.Marshal(res)
+		b = append(b, '\n')
+		if key != "" {
+			idem.finish(key, status, b)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write(b)
+	}
+}
@@ -0,0 +1,53 @@
+package httpx
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"orderpulse-api/internal/stream"
+	"orderpulse-api/internal/subscription"
+	"orderpulse-api/pkg/jwt"
+)
+
+// A filter expression that does not compile is refused up front with the
+// compiler's message, whichever way the client subscribes.
+func TestBadFilterIs400(t *testing.T) {
+	hub := stream.NewHub(nil)
+	defer hub.Close()
+	val := jwt.New(nil, 0)
+	subs, err := subscription.New(hub, subscription.Options{AllowPrivate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := "?filter=" + url.QueryEscape("price > 10")
+
+	tests := []struct {
+		name string
+		h    http.Handler
+		req  *http.Request
+	}{
+		{"sse", Auth(false, val)(stream.SSE(hub)), httptest.NewRequest(http.MethodGet, "/"+query, nil)},
+		{"ws", WS(nil, hub, val, nil), httptest.NewRequest(http.MethodGet, "/"+query, nil)},
+		{"subscription", Auth(false, val)(Subscriptions(subs, "admin")), httptest.NewRequest(http.MethodPost, "/",
+			strings.NewReader(`{"url": "http://127.0.0.1:1/hook", "filter": {"expr": "price > 10"}}`))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.req.Header.Set("Authorization", "Bearer demo")
+			rec := httptest.NewRecorder()
+			tt.h.ServeHTTP(rec, tt.req)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status %d, want 400", rec.Code)
+			}
+			if body := rec.Body.String(); !strings.Contains(body, "filter: ") || !strings.Contains(body, "price") {
+				t.Fatalf("body %q does not explain the error", body)
+			}
+		})
+	}
+	if n := len(subs.List("")); n != 0 {
+		t.Fatalf("%d subscriptions created", n)
+	}
+}
@@ -0,0 +1,63 @@
+package httpx
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/input"
+	"orderpulse-api/internal/webhook"
+)
+
+// Hooks serves /api/hooks/{source}: signature and replay checks replace JWT
+// auth here. pubs holds one publisher per configured source; events are
+// committed to the log before the 204, since the platform will not retry
+// after it.
+func Hooks(pubs map[string]input.Publisher, rcv *webhook.Receiver) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		source := chi.URLParam(r, "source")
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			WriteError(w, http.StatusRequestEntityTooLarge, "too_large", "body too large")
+			return
+		}
+		d, evs, err := rcv.Receive(source, r.Header, body)
+		switch {
+		case errors.Is(err, webhook.ErrUnknownSource):
+			WriteError(w, http.StatusNotFound, "not_found", "unknown webhook source")
+			return
+		case errors.Is(err, webhook.ErrSignature):
+			WriteError(w, http.StatusUnauthorized, "bad_signature", "signature verification failed")
+			return
+		case errors.Is(err, webhook.ErrReplay):
+			WriteError(w, http.StatusConflict, "replayed", err.Error())
+			return
+		case err != nil:
+			WriteError(w, http.StatusUnprocessableEntity, "bad_payload", err.Error())
+			return
+		}
+		for i := range evs {
+			if err := validateEvent(&evs[i]); err != nil {
+				WriteError(w, http.StatusUnprocessableEntity, "bad_payload", err.Error())
+				return
+			}
+		}
+		publish := pubs[source].Publish
+		if d, ok := pubs[source].(input.DurablePublisher); ok {
+			publish = d.PublishDurable
+		}
+		for _, ev := range evs {
+			if err := publish(ev); err != nil {
+				log.Error().Err(err).Str("source", source).Msg("webhook publish")
+				// Let the platform's retry through; events already published
+				// are caught by dedup.
+				rcv.Forget(source, d)
+				WriteError(w, http.StatusServiceUnavailable, "unavailable", "event not persisted")
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
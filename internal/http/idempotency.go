@@ -0,0 +1,85 @@
+package httpx
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+type idemEntry struct {
+	hash    [32]byte
+	done    bool
+	status  int
+	body    []byte
+	expires time.Time
+}
+
+// idempotency remembers responses per (subject, Idempotency-Key) so retried
+// publishes are answered from cache instead of republishing.
+type idempotency struct {
+	ttl     time.Duration
+	max     int
+	mu      sync.Mutex
+	entries map[string]*idemEntry
+}
+
+func newIdempotency(ttl time.Duration, max int) *idempotency {
+	return &idempotency{ttl: ttl, max: max, entries: map[string]*idemEntry{}}
+}
+
+type idemResult int
+
+const (
+	idemNew idemResult = iota
+	idemReplay
+	idemInFlight
+	idemMismatch
+)
+
+func (c *idempotency) begin(key string, body []byte) (idemResult, *idemEntry) {
+	h := sha256.Sum256(body)
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		switch {
+		case e.hash != h:
+			return idemMismatch, nil
+		case !e.done:
+			return idemInFlight, nil
+		default:
+			return idemReplay, e
+		}
+	}
+	if len(c.entries) >= c.max {
+		c.evict(now)
+	}
+	c.entries[key] = &idemEntry{hash: h, expires: now.Add(c.ttl)}
+	return idemNew, nil
+}
+
+func (c *idempotency) finish(key string, status int, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.done, e.status, e.body = true, status, body
+	}
+}
+
+// evict drops expired entries, and if that is not enough, the ones closest to
+// expiry.
+func (c *idempotency) evict(now time.Time) {
+	var oldest string
+	for k, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, k)
+			continue
+		}
+		if oldest == "" || e.expires.Before(c.entries[oldest].expires) {
+			oldest = k
+		}
+	}
+	if len(c.entries) >= c.max && oldest != "" {
+		delete(c.entries, oldest)
+	}
+}
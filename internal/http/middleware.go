@@ -1,8 +1,11 @@
 package httpx
 
 import (
+	"bufio"
 	"context"
 	"crypto/subtle"
+	"errors"
+	"net"
 	"net/http"
 	"strings"
 	"time"
@@ -18,8 +21,9 @@ import (
 type ctxKey string
 
 const (
-	CtxSub   ctxKey = "sub"
-	CtxReqID ctxKey = "reqID"
+	CtxSub    ctxKey = "sub"
+	CtxReqID  ctxKey = "reqID"
+	CtxClaims ctxKey = "claims"
 )
 
 var (
@@ -61,6 +65,25 @@ type respRecorder struct {
 
 func (r *respRecorder) WriteHeader(code int) { r.status = code; r.ResponseWriter.WriteHeader(code) }
 
+// Flush, Hijack and Unwrap keep SSE, WebSocket upgrades and
+// http.ResponseController working behind Logger.
+func (r *respRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *respRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijack not supported")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (r *respRecorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
 func Rate(limit int, per time.Duration) func(http.Handler) http.Handler {
 	return httprate.LimitByIP(limit, per)
 }
@@ -131,13 +154,16 @@ func Auth(optional bool, v *jwt.Validator) func(http.Handler) http.Handler {
 				return
 			}
 			if tok != "" {
-				sub, err := v.Validate(tok)
+				claims, err := v.ValidateClaims(tok)
 				if err != nil && !optional {
 					WriteError(w, http.StatusUnauthorized, "unauthorized", "invalid token")
 					return
 				}
-				if sub != "" {
-					r = r.WithContext(context.WithValue(r.Context(), CtxSub, sub))
+				if err == nil {
+					r = r.WithContext(context.WithValue(r.Context(), CtxClaims, claims))
+				}
+				if claims.Subject != "" {
+					r = r.WithContext(context.WithValue(r.Context(), CtxSub, claims.Subject))
 				}
 			}
 			next.ServeHTTP(w, r)
@@ -145,6 +171,30 @@ func Auth(optional bool, v *jwt.Validator) func(http.Handler) http.Handler {
 	}
 }
 
+func ClaimsFrom(ctx context.Context) (jwt.Claims, bool) {
+	c, ok := ctx.Value(CtxClaims).(jwt.Claims)
+	return c, ok
+}
+
+// RequireScope must run after Auth; it rejects tokens that carry neither a
+// scope nor a role named scope.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, ok := ClaimsFrom(r.Context())
+			if !ok {
+				WriteError(w, http.StatusUnauthorized, "unauthorized", "missing token")
+				return
+			}
+			if !c.Has(scope) {
+				WriteError(w, http.StatusForbidden, "forbidden", "missing scope "+scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func BasicAuth(user, pass string) func(http.Handler) http.Handler {
 	enabled := user != "" && pass != ""
 	return func(next http.Handler) http.Handler {
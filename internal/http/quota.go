@@ -0,0 +1,61 @@
+package httpx
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"orderpulse-api/internal/quota"
+	"orderpulse-api/internal/stream"
+	"orderpulse-api/pkg/jwt"
+)
+
+// StreamQuota must run after Auth; it admits SSE streams against q, paces
+// their delivery and limits how far back they replay. A nil q disables it.
+func StreamQuota(q *quota.Manager) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if q == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c, _ := ClaimsFrom(r.Context())
+			lease, ok := admit(w, r, q, c)
+			if !ok {
+				return
+			}
+			defer lease.Release()
+			ctx := stream.WithMaxReplay(stream.WithThrottle(r.Context(), lease), q.MaxReplay())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// admit opens a quota lease for the stream r, answering 429 when refused.
+func admit(w http.ResponseWriter, r *http.Request, q *quota.Manager, c jwt.Claims) (*quota.Lease, bool) {
+	lease, err := q.Admit(quotaSubject(r, c), c.Tenant)
+	var ex *quota.Exceeded
+	if errors.As(err, &ex) {
+		if ex.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(ex.RetryAfter.Seconds()))))
+		}
+		WriteError(w, http.StatusTooManyRequests, "quota_exceeded", ex.Error())
+		return nil, false
+	}
+	return lease, err == nil
+}
+
+// quotaSubject is who a stream counts against: the token subject, or the
+// client address for anonymous (dev mode) and subject-less tokens, which
+// would otherwise all share one quota.
+func quotaSubject(r *http.Request, c jwt.Claims) string {
+	if c.Subject != "" && !c.Anon {
+		return c.Subject
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "addr:" + host
+}
@@ -0,0 +1,126 @@
+package httpx
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"orderpulse-api/internal/quota"
+	"orderpulse-api/internal/stream"
+	"orderpulse-api/pkg/jwt"
+)
+
+// streamHandler serves SSE behind Auth and StreamQuota the way Router does.
+// Without JWT keys every token is anonymous and counts against the client
+// address, addr:192.0.2.1 for httptest requests.
+func streamHandler(t *testing.T, q *quota.Manager) http.Handler {
+	hub := stream.NewHub(nil)
+	t.Cleanup(hub.Close)
+	return Auth(false, jwt.New(nil, 0))(StreamQuota(q)(stream.SSE(hub)))
+}
+
+// serve runs one stream request until it ends or for d, whichever is first.
+func serve(h http.Handler, target string, d time.Duration) *httptest.ResponseRecorder {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	req := httptest.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	req.Header.Set("Authorization", "Bearer demo")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestStreamQuota(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        quota.Config
+		open       int // streams the client already has
+		wantStatus int
+	}{
+		{"unlimited", quota.Config{}, 3, http.StatusOK},
+		{"under the limit", quota.Config{Subject: quota.Limits{Streams: 2}}, 1, http.StatusOK},
+		{"at the limit", quota.Config{Subject: quota.Limits{Streams: 2}, RetryAfter: 1500 * time.Millisecond}, 2, http.StatusTooManyRequests},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := quota.New(tt.cfg)
+			for range tt.open {
+				l, err := q.Admit("addr:192.0.2.1", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer l.Release()
+			}
+			rec := serve(streamHandler(t, q), "/", 50*time.Millisecond)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusTooManyRequests {
+				return
+			}
+			var body Error
+			_ = json.Unmarshal(rec.Body.Bytes(), &body)
+			if body.Code != "quota_exceeded" || body.Message == "" {
+				t.Fatalf("body %+v", body)
+			}
+			if ra := rec.Header().Get("Retry-After"); ra != "2" {
+				t.Fatalf("Retry-After %q, want 2 (rounded up)", ra)
+			}
+		})
+	}
+}
+
+func TestStreamQuotaReleasesWhenStreamEnds(t *testing.T) {
+	q := quota.New(quota.Config{Subject: quota.Limits{Streams: 1}})
+	serve(streamHandler(t, q), "/", 50*time.Millisecond)
+	l, err := q.Admit("addr:192.0.2.1", "")
+	if err != nil {
+		t.Fatalf("slot still taken after the stream ended: %v", err)
+	}
+	l.Release()
+}
+
+func TestMaxReplayTruncates(t *testing.T) {
+	tests := []struct {
+		since     string
+		maxReplay time.Duration
+		truncated bool
+	}{
+		{"2h", time.Hour, true},
+		{"30m", time.Hour, false},
+		{"2h", 0, false},
+		{time.Now().Add(-3 * time.Hour).UTC().Format(time.RFC3339), time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.since+"/"+tt.maxReplay.String(), func(t *testing.T) {
+			h := streamHandler(t, quota.New(quota.Config{MaxReplay: tt.maxReplay}))
+			rec := serve(h, "/?since="+tt.since, 50*time.Millisecond)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d", rec.Code)
+			}
+			sc := bufio.NewScanner(rec.Body)
+			if !sc.Scan() {
+				if tt.truncated {
+					t.Fatal("no truncated notice")
+				}
+				return
+			}
+			if line := sc.Text(); !tt.truncated || line != "event: truncated" {
+				t.Fatalf("unexpected %q", line)
+			}
+			sc.Scan()
+			var notice struct{ Since time.Time }
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(sc.Text(), "data: ")), &notice); err != nil {
+				t.Fatal(err)
+			}
+			if d := time.Since(notice.Since); d < tt.maxReplay-time.Minute || d > tt.maxReplay+time.Minute {
+				t.Fatalf("replay moved up to %v ago, want about %v", d, tt.maxReplay)
+			}
+		})
+	}
+}
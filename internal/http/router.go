@@ -10,25 +10,59 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"orderpulse-api/internal/config"
+	"orderpulse-api/internal/input"
+	"orderpulse-api/internal/leader"
+	"orderpulse-api/internal/quota"
 	"orderpulse-api/internal/stream"
+	"orderpulse-api/internal/subscription"
 	"orderpulse-api/internal/telemetry"
+	"orderpulse-api/internal/webhook"
 	jwtx "orderpulse-api/pkg/jwt"
 )
 
-func Router(cfg *config.Config, hub *stream.Hub) http.Handler {
+// Services carries components built in main; nil fields disable the routes
+// that need them.
+type Services struct {
+	Inputs *input.Supervisor
+	Ingest *input.Decoder
+	Hooks  *webhook.Receiver
+	Subs   *subscription.Manager
+	Leader *leader.Elector
+	Quota  *quota.Manager
+}
+
+func Router(cfg *config.Config, hub *stream.Hub, svc Services) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(Recoverer, RequestID, SecureHeaders, Logger, Rate(300, time.Minute))
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins: cfg.AllowedOrigins,
-		AllowedMethods: []string{"GET", "POST", "OPTIONS"},
-		AllowedHeaders: []string{"Authorization", "Content-Type"},
+		AllowedMethods: []string{"GET", "POST", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Authorization", "Content-Type", "Idempotency-Key"},
 	}))
 
 	val := jwtx.New(cfg.JWTKeys, cfg.Skew)
+	publisher := func(name string) input.Publisher {
+		if svc.Inputs != nil {
+			return svc.Inputs.Publisher(name)
+		}
+		return hub
+	}
 
 	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
-	r.Get("/readyz", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("ok")) })
+	r.Get("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := hub.Health(); err != nil {
+			WriteError(w, http.StatusServiceUnavailable, "not_ready", "store: "+err.Error())
+			return
+		}
+		if svc.Inputs != nil {
+			if err := svc.Inputs.Ready(); err != nil {
+				WriteError(w, http.StatusServiceUnavailable, "not_ready", err.Error())
+				return
+			}
+		}
+		w.Write([]byte("ok"))
+	})
 
 	r.Get("/api/info", func(w http.ResponseWriter, r *http.Request) {
 		type info struct {
@@ -36,16 +70,31 @@ func Router(cfg *config.Config, hub *stream.Hub) http.Handler {
 			Version  string   `json:"version"`
 			WS       string   `json:"ws"`
 			SSE      string   `json:"sse"`
+			Ingest   string   `json:"ingest,omitempty"`
+			Subs     string   `json:"subscriptions,omitempty"`
 			Origins  []string `json:"origins"`
 			Kafka    bool     `json:"kafka"`
 			RabbitMQ bool     `json:"rabbitmq"`
+			NATS     bool     `json:"nats"`
+			Redis    bool     `json:"redis"`
+			Node     string   `json:"node"`
+			Cluster  string   `json:"cluster,omitempty"`
+			Leader   bool     `json:"leader"`
 		}
-		_ = json.NewEncoder(w).Encode(info{
+		i := info{
 			Name: "orderpulse-api", Version: "1.0.0",
 			WS: "/api/ws", SSE: "/api/stream/events",
 			Origins: cfg.AllowedOrigins,
-			Kafka:   cfg.KafkaEnabled, RabbitMQ: cfg.AmqpEnabled,
-		})
+			Kafka:   cfg.KafkaEnabled, RabbitMQ: cfg.AmqpEnabled, NATS: cfg.NatsEnabled, Redis: cfg.RedisEnabled,
+			Node: cfg.NodeID, Cluster: cfg.ClusterBus, Leader: svc.Leader == nil || svc.Leader.Status().Leader,
+		}
+		if svc.Ingest != nil {
+			i.Ingest = "/api/events"
+		}
+		if svc.Subs != nil {
+			i.Subs = "/api/subscriptions"
+		}
+		_ = json.NewEncoder(w).Encode(i)
 	})
 
 	r.Group(func(g chi.Router) {
@@ -54,15 +103,47 @@ func Router(cfg *config.Config, hub *stream.Hub) http.Handler {
 	})
 
 	r.Group(func(g chi.Router) {
-		g.Use(Auth(false, val))
+		g.Use(Auth(false, val), StreamQuota(svc.Quota))
 		g.Get("/api/stream/events", stream.SSE(hub))
 	})
-	r.Get("/api/ws", WS(cfg.AllowedOrigins, hub, val))
+	r.Get("/api/ws", WS(cfg.AllowedOrigins, hub, val, svc.Quota))
 
 	r.Group(func(g chi.Router) {
 		g.Use(Auth(true, val), BodyLimit(64<<10), Rate(60, time.Minute))
 		g.Post("/api/telemetry", telemetry.Handle)
 	})
 
+	if svc.Ingest != nil {
+		r.Group(func(g chi.Router) {
+			g.Use(Auth(false, val), RequireScope(cfg.IngestScope), BodyLimit(cfg.IngestMaxBytes))
+			g.Post("/api/events", Events(publisher("http"), svc.Ingest, cfg.IngestIdemTTL))
+		})
+	}
+	if svc.Inputs != nil {
+		r.Group(func(g chi.Router) {
+			g.Use(Auth(false, val), RequireScope(cfg.AdminScope))
+			g.Get("/api/admin/inputs", func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(svc.Inputs.Status())
+			})
+		})
+	}
+	if svc.Subs != nil {
+		r.With(Auth(false, val), RequireScope(cfg.SubsScope), BodyLimit(64<<10)).
+			Mount("/api/subscriptions", Subscriptions(svc.Subs, cfg.AdminScope))
+	}
+	if svc.Hooks != nil {
+		// A 2xx tells the platform to stop retrying, so hooks wait for the
+		// log commit before answering.
+		pubs := map[string]input.Publisher{}
+		for _, name := range svc.Hooks.Sources() {
+			pubs[name] = hub
+			if svc.Inputs != nil {
+				pubs[name] = svc.Inputs.AckingPublisher("hook:" + name)
+			}
+		}
+		r.With(BodyLimit(1<<20)).Post("/api/hooks/{source}", Hooks(pubs, svc.Hooks))
+	}
+
 	return r
 }
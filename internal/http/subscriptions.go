@@ -0,0 +1,119 @@
+package httpx
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"orderpulse-api/internal/stream"
+	"orderpulse-api/internal/subscription"
+)
+
+type subscriptionReq struct {
+	URL     string        `json:"url"`
+	Secret  string        `json:"secret"`
+	Filter  stream.Filter `json:"filter"`
+	Enabled *bool         `json:"enabled"`
+}
+
+// Subscriptions serves /api/subscriptions. Callers see their own
+// subscriptions; holders of adminScope see everyone's.
+func Subscriptions(m *subscription.Manager, adminScope string) http.Handler {
+	owner := func(r *http.Request) (sub, scope string) {
+		c, _ := ClaimsFrom(r.Context())
+		if c.Has(adminScope) {
+			return c.Subject, ""
+		}
+		return c.Subject, c.Subject
+	}
+	writeJSON := func(w http.ResponseWriter, status int, v any) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(v)
+	}
+	fail := func(w http.ResponseWriter, err error) {
+		if errors.Is(err, subscription.ErrNotFound) {
+			WriteError(w, http.StatusNotFound, "not_found", err.Error())
+			return
+		}
+		WriteError(w, http.StatusInternalServerError, "internal", err.Error())
+	}
+
+	r := chi.NewRouter()
+	// An empty owner scope means "everyone's", so callers without a subject
+	// must not get one unless they are admins.
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c, _ := ClaimsFrom(r.Context()); c.Subject == "" && !c.Has(adminScope) {
+				WriteError(w, http.StatusForbidden, "forbidden", "token has no subject")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		var req subscriptionReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			WriteError(w, http.StatusBadRequest, "bad_request", "invalid json")
+			return
+		}
+		sub, _ := owner(r)
+		s, err := m.Create(sub, req.URL, req.Secret, req.Filter)
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		// The secret is only ever returned here.
+		s.Log = nil
+		writeJSON(w, http.StatusCreated, s)
+	})
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		_, scope := owner(r)
+		writeJSON(w, http.StatusOK, m.List(scope))
+	})
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, scope := owner(r)
+		s, err := m.Get(scope, chi.URLParam(r, "id"))
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.Public())
+	})
+	r.Get("/{id}/deliveries", func(w http.ResponseWriter, r *http.Request) {
+		_, scope := owner(r)
+		s, err := m.Get(scope, chi.URLParam(r, "id"))
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		if s.Log == nil {
+			s.Log = []subscription.Delivery{}
+		}
+		writeJSON(w, http.StatusOK, s.Log)
+	})
+	r.Patch("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req subscriptionReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Enabled == nil {
+			WriteError(w, http.StatusBadRequest, "bad_request", "expected {\"enabled\": bool}")
+			return
+		}
+		_, scope := owner(r)
+		s, err := m.SetEnabled(scope, chi.URLParam(r, "id"), *req.Enabled)
+		if err != nil {
+			fail(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, s)
+	})
+	r.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		_, scope := owner(r)
+		if err := m.Delete(scope, chi.URLParam(r, "id")); err != nil {
+			fail(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return r
+}
@@ -1,17 +1,32 @@
 package httpx
 
 import (
-	"encoding/json"
+	"context"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"orderpulse-api/internal/models"
+	"orderpulse-api/internal/quota"
 	"orderpulse-api/internal/stream"
 	"orderpulse-api/pkg/jwt"
 )
 
-func WS(allowedOrigins []string, hub *stream.Hub, v *jwt.Validator) http.HandlerFunc {
+// wsControl is an in-band notice; clients tell it from events by the
+// "control" field.
+type wsControl struct {
+	Control string `json:"control"`
+	Skipped uint64 `json:"skipped,omitempty"`
+	Since   string `json:"since,omitempty"`
+}
+
+// wsPongWait is how long a client may go without answering the 15s pings.
+const wsPongWait = 45 * time.Second
+
+// WS streams events over a WebSocket, replaying from ?since= first when
+// asked; q, when set, applies stream quotas.
+func WS(allowedOrigins []string, hub *stream.Hub, v *jwt.Validator, q *quota.Manager) http.HandlerFunc {
 	upgrader := websocket.Upgrader{
 		Subprotocols: []string{"bearer"},
 		CheckOrigin: func(r *http.Request) bool {
@@ -30,37 +45,116 @@ func WS(allowedOrigins []string, hub *stream.Hub, v *jwt.Validator) http.Handler
 
 	return func(w http.ResponseWriter, r *http.Request) {
 		tok := extractToken(r)
-		if _, err := v.Validate(tok); err != nil {
+		claims, err := v.ValidateClaims(tok)
+		if err != nil {
 			WriteError(w, http.StatusUnauthorized, "unauthorized", "invalid token")
 			return
 		}
 
+		opts, err := stream.QueryOptions(r.URL.Query())
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		proj, err := stream.ProjectionFromQuery(r.URL.Query())
+		if err != nil {
+			WriteError(w, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		lag := &stream.Lag{}
+		opts = append(opts, stream.Track(lag))
+
+		var lease *quota.Lease
+		if q != nil {
+			var ok bool
+			if lease, ok = admit(w, r, q, claims); !ok {
+				return
+			}
+			defer lease.Release()
+			r = r.WithContext(stream.WithMaxReplay(r.Context(), q.MaxReplay()))
+		}
+		since, truncated := stream.Resume(r)
+
 		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			return
 		}
 		defer conn.Close()
 
-		sub := hub.Subscribe(r.Context(), 256)
+		// Hijacked connections do not cancel the request context, so the read
+		// loop ends the stream (and frees its quota lease) when the client
+		// closes or stops answering pings.
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		conn.SetReadLimit(4 << 10)
+		_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+		conn.SetPongHandler(func(string) error { return conn.SetReadDeadline(time.Now().Add(wsPongWait)) })
+		go func() {
+			defer cancel()
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		sub := hub.Subscribe(ctx, 256, opts...)
+		if !since.IsZero() {
+			if truncated {
+				if err := conn.WriteJSON(wsControl{Control: "truncated", Since: since.UTC().Format(time.RFC3339Nano)}); err != nil {
+					return
+				}
+			}
+			go hub.ReplaySince(since, sub)
+		}
 
 		tick := time.NewTicker(15 * time.Second)
 		defer tick.Stop()
 		go func() {
-			for range tick.C {
-				_ = conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(5*time.Second))
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-tick.C:
+					_ = conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(5*time.Second))
+				}
 			}
 		}()
 
 		for {
 			select {
-			case <-r.Context().Done():
+			case <-ctx.Done():
 				return
-			case ev := <-sub:
-				b, _ := json.Marshal(ev)
-				if err := conn.WriteMessage(websocket.TextMessage, b); err != nil {
+			case ev, ok := <-sub:
+				if !ok {
+					if lag.Lagged() {
+						_ = conn.WriteJSON(wsControl{Control: "lagged", Skipped: lag.Skipped()})
+						_ = conn.WriteControl(websocket.CloseMessage,
+							websocket.FormatCloseMessage(4008, "lagged"), time.Now().Add(time.Second))
+					}
+					return
+				}
+				if lease != nil && lease.Wait(ctx) != nil {
+					return
+				}
+				if n := lag.Skipped(); n > 0 {
+					if err := conn.WriteJSON(wsControl{Control: "skipped", Skipped: n}); err != nil {
+						return
+					}
+				}
+				if err := conn.WritePreparedMessage(prepared(proj, ev)); err != nil {
 					return
 				}
 			}
 		}
 	}
 }
+
+// prepared returns ev under p as a WebSocket message whose frames are built
+// once per event and shared by every connection using p.
+func prepared(p stream.Projection, ev models.OrderEvent) *websocket.PreparedMessage {
+	return p.Cached(ev, "ws", func(payload []byte) any {
+		pm, _ := websocket.NewPreparedMessage(websocket.TextMessage, payload)
+		return pm
+	}).(*websocket.PreparedMessage)
+}
@@ -0,0 +1,67 @@
+package input
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/codec"
+	"orderpulse-api/internal/deadletter"
+	"orderpulse-api/internal/mapping"
+	"orderpulse-api/internal/models"
+)
+
+// Decoder is the decode path shared by every input: pick a codec for the
+// message, decode it and map the result onto an OrderEvent. Messages that
+// fail either step are written to the dead-letter log.
+type Decoder struct {
+	Source     string
+	Codecs     *codec.Set
+	Format     codec.Format
+	Mapper     *mapping.Mapper
+	DeadLetter *deadletter.Writer
+}
+
+func NewDecoder(source string, codecs *codec.Set, format codec.Format) *Decoder {
+	return &Decoder{Source: source, Codecs: codecs, Format: format}
+}
+
+func (d *Decoder) Decode(ctx context.Context, contentType string, data []byte) (models.OrderEvent, error) {
+	doc, err := d.decode(ctx, contentType, data)
+	if err != nil {
+		d.reject("decode", err, contentType, data)
+		return models.OrderEvent{}, err
+	}
+	var ev models.OrderEvent
+	if d.Mapper != nil {
+		ev, err = d.Mapper.Map(doc)
+	} else {
+		ev, err = codec.ToEvent(doc)
+	}
+	if err == nil && !models.ValidChannel(ev.Channel) {
+		err = fmt.Errorf("channel: invalid name %q", ev.Channel)
+	}
+	if err != nil {
+		d.reject("map", err, contentType, data)
+		return ev, err
+	}
+	if ev.TS.IsZero() {
+		ev.TS = time.Now().UTC()
+	}
+	return ev, nil
+}
+
+func (d *Decoder) decode(ctx context.Context, contentType string, data []byte) (map[string]any, error) {
+	dec, err := d.Codecs.For(ctx, d.Format, contentType, data)
+	if err != nil {
+		return nil, err
+	}
+	return dec.Decode(ctx, data)
+}
+
+func (d *Decoder) reject(stage string, cause error, contentType string, data []byte) {
+	if err := d.DeadLetter.Write(d.Source, stage, cause, contentType, data); err != nil {
+		log.Error().Err(err).Str("source", d.Source).Msg("deadletter")
+	}
+}
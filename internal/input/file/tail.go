@@ -0,0 +1,206 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/input"
+)
+
+// Tailer follows an NDJSON file like tail -F: it survives rename/recreate
+// rotation and truncation, and persists its read offset so a restart picks
+// up where it left off.
+type Tailer struct {
+	path       string
+	offsetPath string
+	poll       time.Duration
+	dec        *input.Decoder
+}
+
+type position struct {
+	Offset int64 `json:"offset"`
+	// Head fingerprints the first HeadLen bytes so a persisted offset is not
+	// applied to a different file after rotation.
+	Head    string `json:"head"`
+	HeadLen int64  `json:"headLen"`
+}
+
+const headMax = 256
+
+func NewTailer(path, offsetPath string, poll time.Duration, dec *input.Decoder) *Tailer {
+	if offsetPath == "" {
+		offsetPath = path + ".offset"
+	}
+	if poll <= 0 {
+		poll = time.Second
+	}
+	return &Tailer{path: path, offsetPath: offsetPath, poll: poll, dec: dec}
+}
+
+// AcksAfterPublish implements input.Acker: the offset advances past a line
+// once Publish succeeds.
+func (t *Tailer) AcksAfterPublish() bool { return true }
+
+func (t *Tailer) Run(ctx context.Context, pub input.Publisher) error {
+	for {
+		err := t.follow(ctx, pub)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(t.poll):
+		}
+	}
+}
+
+// follow reads one incarnation of the file until it is rotated away.
+func (t *Tailer) follow(ctx context.Context, pub input.Publisher) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var pos position
+	if saved, err := t.load(); err == nil && saved.Head == fingerprint(f, saved.HeadLen) {
+		pos = saved
+	}
+	if _, err := f.Seek(pos.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(f)
+	var partial []byte
+	dirty := false
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			line = append(partial, line...)
+			partial = nil
+			if err := t.handle(ctx, line, pub); err != nil {
+				// Keep the offset before this line; the supervisor restarts
+				// us and the line is read again.
+				if dirty {
+					t.checkpoint(f, pos)
+				}
+				return err
+			}
+			pos.Offset += int64(len(line))
+			dirty = true
+			continue
+		}
+		partial = append(partial, line...)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		if dirty {
+			t.checkpoint(f, pos)
+			dirty = false
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(t.poll):
+		}
+
+		cur, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		next, err := os.Stat(t.path)
+		switch {
+		case err != nil || !os.SameFile(cur, next):
+			// Rotated: finish whatever was appended to the old file first.
+			t.drain(ctx, r, partial, pub)
+			return nil
+		case next.Size() < pos.Offset+int64(len(partial)):
+			log.Info().Str("path", t.path).Msg("tail truncated")
+			return t.save(position{Head: fingerprint(f, 0)})
+		}
+	}
+}
+
+// drain publishes what is left of a rotated file. The file cannot be
+// reopened by path once we return, so a failed publish is retried every
+// poll interval instead, and the offset file is only removed once every
+// line went through.
+func (t *Tailer) drain(ctx context.Context, r *bufio.Reader, partial []byte, pub input.Publisher) {
+	rest, _ := io.ReadAll(r)
+	for _, line := range bytes.Split(append(partial, rest...), []byte{'\n'}) {
+		for t.handle(ctx, line, pub) != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(t.poll):
+			}
+		}
+	}
+	_ = os.Remove(t.offsetPath)
+}
+
+// handle publishes one line. Lines that do not decode are logged and
+// skipped; only a failed Publish is returned.
+func (t *Tailer) handle(ctx context.Context, line []byte, pub input.Publisher) error {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+	ev, err := t.dec.Decode(ctx, "application/json", line)
+	if err != nil {
+		log.Warn().Err(err).Str("path", t.path).Msg("tail decode")
+		return nil
+	}
+	if err := pub.Publish(ev); err != nil {
+		log.Error().Err(err).Str("path", t.path).Msg("tail publish")
+		return err
+	}
+	return nil
+}
+
+func (t *Tailer) checkpoint(f *os.File, pos position) {
+	pos.HeadLen = min(pos.Offset, headMax)
+	pos.Head = fingerprint(f, pos.HeadLen)
+	if err := t.save(pos); err != nil {
+		log.Warn().Err(err).Str("path", t.offsetPath).Msg("tail offset")
+	}
+}
+
+func (t *Tailer) load() (position, error) {
+	var p position
+	b, err := os.ReadFile(t.offsetPath)
+	if err != nil {
+		return p, err
+	}
+	return p, json.Unmarshal(b, &p)
+}
+
+func (t *Tailer) save(p position) error {
+	b, _ := json.Marshal(p)
+	tmp := t.offsetPath + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.offsetPath)
+}
+
+func fingerprint(f *os.File, n int64) string {
+	buf := make([]byte, n)
+	k, _ := f.ReadAt(buf, 0)
+	sum := sha256.Sum256(buf[:k])
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,182 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"orderpulse-api/internal/codec"
+	"orderpulse-api/internal/input"
+	"orderpulse-api/internal/models"
+)
+
+// publisher records event IDs and fails while failing is set.
+type publisher struct {
+	mu      sync.Mutex
+	ids     []string
+	calls   int
+	failing bool
+}
+
+func (p *publisher) Publish(ev models.OrderEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.failing {
+		return errors.New("log unavailable")
+	}
+	p.ids = append(p.ids, ev.ID)
+	return nil
+}
+
+func (p *publisher) setFailing(v bool) {
+	p.mu.Lock()
+	p.failing = v
+	p.mu.Unlock()
+}
+
+func (p *publisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.ids...)
+}
+
+func (p *publisher) callCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func newTailer(path string) *Tailer {
+	return NewTailer(path, "", 20*time.Millisecond, input.NewDecoder("file", codec.NewSet(nil), codec.JSON))
+}
+
+// run restarts the tailer whenever Run returns, as the supervisor does.
+func run(t *testing.T, tl *Tailer, pub input.Publisher) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for tl.Run(ctx, pub) != context.Canceled {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+const line1 = `{"id":"e1","orderId":"o-1"}` + "\n"
+
+func TestFailedPublishIsReadAgain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.ndjson")
+	if err := os.WriteFile(path, []byte(line1+`{"id":"e2","orderId":"o-2"}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tl := newTailer(path)
+	pub := &publisher{}
+	pub.setFailing(true)
+	run(t, tl, pub)
+
+	// e1 keeps failing, so the offset must not move past it.
+	eventually(t, "retries", func() bool { return pub.callCount() >= 3 })
+	if pos, err := tl.load(); err == nil && pos.Offset != 0 {
+		t.Fatalf("offset %d saved before anything was published", pos.Offset)
+	}
+	pub.setFailing(false)
+	eventually(t, "e1 and e2", func() bool { return len(pub.published()) == 2 })
+	if ids := pub.published(); !slices.Equal(ids, []string{"e1", "e2"}) {
+		t.Fatalf("published %v", ids)
+	}
+	eventually(t, "saved offset", func() bool {
+		pos, err := tl.load()
+		return err == nil && pos.Offset == int64(len(line1)+len(`{"id":"e2","orderId":"o-2"}`+"\n"))
+	})
+}
+
+func TestOffsetStopsAtFailedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.ndjson")
+	if err := os.WriteFile(path, []byte(line1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tl := newTailer(path)
+	pub := &publisher{}
+	run(t, tl, pub)
+	eventually(t, "e1", func() bool { return len(pub.published()) == 1 })
+
+	pub.setFailing(true)
+	calls := pub.callCount()
+	appendLine(t, path, `{"id":"e2","orderId":"o-2"}`+"\n")
+	eventually(t, "e2 attempted twice", func() bool { return pub.callCount() >= calls+2 })
+	pos, err := tl.load()
+	if err != nil || pos.Offset != int64(len(line1)) {
+		t.Fatalf("offset %+v, %v; want it just past e1", pos, err)
+	}
+
+	pub.setFailing(false)
+	eventually(t, "e2", func() bool { return len(pub.published()) == 2 })
+	if ids := pub.published(); !slices.Equal(ids, []string{"e1", "e2"}) {
+		t.Fatalf("published %v", ids)
+	}
+}
+
+func TestDrainKeepsOffsetUntilPublished(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "orders.ndjson")
+	if err := os.WriteFile(path, []byte(line1), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tl := NewTailer(path, "", 200*time.Millisecond, input.NewDecoder("file", codec.NewSet(nil), codec.JSON))
+	pub := &publisher{}
+	run(t, tl, pub)
+	eventually(t, "e1", func() bool { return len(pub.published()) == 1 })
+	eventually(t, "saved offset", func() bool { _, err := tl.load(); return err == nil })
+
+	// Append and rotate within one poll, so e2 is only seen by drain.
+	pub.setFailing(true)
+	calls := pub.callCount()
+	appendLine(t, path, `{"id":"e2","orderId":"o-2"}`+"\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "e2 attempted twice", func() bool { return pub.callCount() >= calls+2 })
+	if _, err := tl.load(); err != nil {
+		t.Fatalf("offset file removed with e2 unpublished: %v", err)
+	}
+
+	pub.setFailing(false)
+	eventually(t, "e2", func() bool { return len(pub.published()) == 2 })
+	eventually(t, "offset file removed", func() bool {
+		_, err := os.Stat(tl.offsetPath)
+		return errors.Is(err, os.ErrNotExist)
+	})
+}
+
+func appendLine(t *testing.T, path, line string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(line); err != nil {
+		t.Fatal(err)
+	}
+}
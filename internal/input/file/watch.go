@@ -0,0 +1,114 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/input"
+)
+
+// Watcher picks up batch files dropped into a directory, publishes every
+// line and moves the file to processed/. Files are only read once they have
+// not been modified for a full poll interval, so slow writers are not read
+// half-way.
+type Watcher struct {
+	dir     string
+	pattern string
+	poll    time.Duration
+	dec     *input.Decoder
+}
+
+func NewWatcher(dir, pattern string, poll time.Duration, dec *input.Decoder) *Watcher {
+	if pattern == "" {
+		pattern = "*.ndjson"
+	}
+	if poll <= 0 {
+		poll = time.Second
+	}
+	return &Watcher{dir: dir, pattern: pattern, poll: poll, dec: dec}
+}
+
+// AcksAfterPublish implements input.Acker: a file is moved to processed/
+// once its events are published.
+func (w *Watcher) AcksAfterPublish() bool { return true }
+
+func (w *Watcher) Run(ctx context.Context, pub input.Publisher) error {
+	if err := os.MkdirAll(filepath.Join(w.dir, "processed"), 0o755); err != nil {
+		return err
+	}
+	t := time.NewTicker(w.poll)
+	defer t.Stop()
+	for {
+		if err := w.scan(ctx, pub); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (w *Watcher) scan(ctx context.Context, pub input.Publisher) error {
+	names, err := filepath.Glob(filepath.Join(w.dir, w.pattern))
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil || !fi.Mode().IsRegular() || time.Since(fi.ModTime()) < w.poll {
+			continue
+		}
+		if err := w.process(ctx, name, pub); err != nil {
+			// Left in place and retried on the next scan.
+			log.Error().Err(err).Str("file", name).Msg("watch publish")
+			continue
+		}
+		dst := filepath.Join(w.dir, "processed", filepath.Base(name))
+		if err := os.Rename(name, dst); err != nil {
+			return err
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (w *Watcher) process(ctx context.Context, name string, pub input.Publisher) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64<<10), 4<<20)
+	n := 0
+	for sc.Scan() {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		ev, err := w.dec.Decode(ctx, "application/json", sc.Bytes())
+		if err != nil {
+			log.Warn().Err(err).Str("file", name).Msg("watch decode")
+			continue
+		}
+		if err := pub.Publish(ev); err != nil {
+			return err
+		}
+		n++
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	log.Info().Str("file", name).Int("events", n).Msg("watch batch")
+	return nil
+}
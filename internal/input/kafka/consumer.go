@@ -2,45 +2,49 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
-	"time"
+	"strings"
 
 	"github.com/rs/zerolog/log"
 	"github.com/segmentio/kafka-go"
-	"orderpulse-api/internal/models"
-	"orderpulse-api/internal/stream"
+	"orderpulse-api/internal/input"
 )
 
 type Consumer struct {
-	reader *kafka.Reader
-	hub    *stream.Hub
+	cfg kafka.ReaderConfig
+	dec *input.Decoder
 }
 
-func New(brokers []string, topic, group string, hub *stream.Hub) *Consumer {
-	r := kafka.NewReader(kafka.ReaderConfig{
+func New(brokers []string, topic, group string, dec *input.Decoder) *Consumer {
+	return &Consumer{cfg: kafka.ReaderConfig{
 		Brokers:  brokers,
 		Topic:    topic,
 		GroupID:  group,
 		MaxBytes: 10e6,
-	})
-	return &Consumer{reader: r, hub: hub}
+	}, dec: dec}
 }
 
-func (c *Consumer) Run(ctx context.Context) error {
-	defer c.reader.Close()
+func (c *Consumer) Run(ctx context.Context, pub input.Publisher) error {
+	r := kafka.NewReader(c.cfg)
+	defer r.Close()
 	for {
-		m, err := c.reader.ReadMessage(ctx)
+		m, err := r.ReadMessage(ctx)
 		if err != nil {
 			return err
 		}
-		ev := models.OrderEvent{}
-		if err := json.Unmarshal(m.Value, &ev); err != nil {
+		ev, err := c.dec.Decode(ctx, contentType(m.Headers), m.Value)
+		if err != nil {
 			log.Warn().Err(err).Msg("kafka decode")
 			continue
 		}
-		if ev.TS.IsZero() {
-			ev.TS = time.Now().UTC()
+		_ = pub.Publish(ev)
+	}
+}
+
+func contentType(hs []kafka.Header) string {
+	for _, h := range hs {
+		if strings.EqualFold(h.Key, "content-type") {
+			return string(h.Value)
 		}
-		c.hub.Publish(ev)
 	}
+	return ""
 }
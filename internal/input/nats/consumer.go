@@ -0,0 +1,145 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/input"
+)
+
+type Options struct {
+	URL     string
+	Subject string
+	// Queue joins a core NATS queue group; ignored for JetStream.
+	Queue string
+	// Stream and Durable switch to a durable JetStream pull consumer.
+	Stream  string
+	Durable string
+	AckWait time.Duration
+}
+
+type Consumer struct {
+	opts Options
+	dec  *input.Decoder
+}
+
+func New(opts Options, dec *input.Decoder) *Consumer {
+	if opts.AckWait <= 0 {
+		opts.AckWait = 30 * time.Second
+	}
+	return &Consumer{opts: opts, dec: dec}
+}
+
+func (c *Consumer) Run(ctx context.Context, pub input.Publisher) error {
+	closed := make(chan struct{})
+	nc, err := nats.Connect(c.opts.URL,
+		nats.Name("orderpulse-api"),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2*time.Second),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Warn().Err(err).Msg("nats disconnected")
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Info().Str("url", nc.ConnectedUrl()).Msg("nats reconnected")
+		}),
+		nats.ClosedHandler(func(*nats.Conn) { close(closed) }),
+	)
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+
+	if c.opts.Stream != "" {
+		return c.runJetStream(ctx, nc, closed, pub)
+	}
+	return c.runCore(ctx, nc, closed, pub)
+}
+
+func (c *Consumer) runCore(ctx context.Context, nc *nats.Conn, closed <-chan struct{}, pub input.Publisher) error {
+	msgs := make(chan *nats.Msg, 256)
+	sub, err := nc.ChanQueueSubscribe(c.opts.Subject, c.opts.Queue, msgs)
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-closed:
+			return nats.ErrConnectionClosed
+		case m := <-msgs:
+			ev, err := c.dec.Decode(ctx, m.Header.Get("Content-Type"), m.Data)
+			if err != nil {
+				log.Warn().Err(err).Msg("nats decode")
+				continue
+			}
+			_ = pub.Publish(ev)
+		}
+	}
+}
+
+// AcksAfterPublish implements input.Acker for JetStream consumers; core
+// subscriptions have nothing to ack.
+func (c *Consumer) AcksAfterPublish() bool { return c.opts.Stream != "" }
+
+// runJetStream acks only after the event has been published (and appended to
+// the log); undecodable messages are terminated so they are not redelivered.
+func (c *Consumer) runJetStream(ctx context.Context, nc *nats.Conn, closed <-chan struct{}, pub input.Publisher) error {
+	js, err := jetstream.New(nc)
+	if err != nil {
+		return err
+	}
+	cons, err := js.CreateOrUpdateConsumer(ctx, c.opts.Stream, jetstream.ConsumerConfig{
+		Durable:       c.opts.Durable,
+		FilterSubject: c.opts.Subject,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       c.opts.AckWait,
+	})
+	if err != nil {
+		return err
+	}
+	it, err := cons.Messages()
+	if err != nil {
+		return err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-closed:
+		}
+		it.Stop()
+	}()
+
+	for {
+		m, err := it.Next()
+		if err != nil {
+			if errors.Is(err, jetstream.ErrMsgIteratorClosed) {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return nats.ErrConnectionClosed
+			}
+			return err
+		}
+		ev, err := c.dec.Decode(ctx, m.Headers().Get("Content-Type"), m.Data())
+		if err != nil {
+			log.Warn().Err(err).Msg("nats decode")
+			_ = m.Term()
+			continue
+		}
+		if err := pub.Publish(ev); err != nil {
+			log.Error().Err(err).Msg("nats append")
+			_ = m.Nak()
+			continue
+		}
+		if err := m.Ack(); err != nil {
+			log.Warn().Err(err).Msg("nats ack")
+		}
+	}
+}
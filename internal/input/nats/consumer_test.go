@@ -0,0 +1,246 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"orderpulse-api/internal/codec"
+	"orderpulse-api/internal/input"
+	"orderpulse-api/internal/models"
+)
+
+// runServer starts an in-process NATS server with JetStream enabled.
+func runServer(t *testing.T) string {
+	t.Helper()
+	s, err := server.NewServer(&server.Options{
+		Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir(), NoLog: true, NoSigs: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Start()
+	if !s.ReadyForConnections(10 * time.Second) {
+		t.Fatal("nats server did not start")
+	}
+	t.Cleanup(s.Shutdown)
+	return s.ClientURL()
+}
+
+// publisher records events and answers Publish with whatever fail returns.
+type publisher struct {
+	mu     sync.Mutex
+	events []models.OrderEvent
+	fail   func(n int) error // n counts calls from 1
+	calls  int
+	got    chan struct{}
+}
+
+func newPublisher(fail func(int) error) *publisher {
+	return &publisher{fail: fail, got: make(chan struct{}, 64)}
+}
+
+func (p *publisher) Publish(ev models.OrderEvent) error {
+	p.mu.Lock()
+	p.calls++
+	var err error
+	if p.fail != nil {
+		err = p.fail(p.calls)
+	}
+	if err == nil {
+		p.events = append(p.events, ev)
+	}
+	p.mu.Unlock()
+	p.got <- struct{}{}
+	return err
+}
+
+func (p *publisher) wait(t *testing.T, calls int) {
+	t.Helper()
+	for range calls {
+		select {
+		case <-p.got:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for %d publishes", calls)
+		}
+	}
+}
+
+func (p *publisher) ids() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var ids []string
+	for _, ev := range p.events {
+		ids = append(ids, ev.ID)
+	}
+	return ids
+}
+
+func start(t *testing.T, c *Consumer, pub input.Publisher) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Run(ctx, pub)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+func decoder() *input.Decoder { return input.NewDecoder("nats", codec.NewSet(nil), codec.JSON) }
+
+func TestCoreSubscription(t *testing.T) {
+	url := runServer(t)
+	pub := newPublisher(nil)
+	c := New(Options{URL: url, Subject: "orders.>"}, decoder())
+	if c.AcksAfterPublish() {
+		t.Fatal("core subscriptions have nothing to ack")
+	}
+	start(t, c, pub)
+
+	nc, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	// The subscription starts asynchronously; keep publishing until it is up.
+	deadline := time.Now().Add(10 * time.Second)
+	for len(pub.ids()) == 0 && time.Now().Before(deadline) {
+		_ = nc.Publish("orders.created", []byte(`{"id":"e1","orderId":"o1","type":"created"}`))
+		time.Sleep(50 * time.Millisecond)
+	}
+	if ids := pub.ids(); len(ids) == 0 || ids[0] != "e1" {
+		t.Fatalf("got %v", ids)
+	}
+}
+
+func jetStream(t *testing.T, url string) (jetstream.JetStream, jetstream.Stream) {
+	t.Helper()
+	nc, err := nats.Connect(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "ORDERS", Subjects: []string{"orders.>"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return js, st
+}
+
+// pending reports the durable consumer's unacked and undelivered counts;
+// -1 until the consumer under test has created it.
+func pending(t *testing.T, st jetstream.Stream) (ackPending, numPending int) {
+	t.Helper()
+	cons, err := st.Consumer(context.Background(), "api")
+	if errors.Is(err, jetstream.ErrConsumerNotFound) {
+		return -1, -1
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := cons.Info(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return info.NumAckPending, int(info.NumPending)
+}
+
+func waitSettled(t *testing.T, st jetstream.Stream) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if a, n := pending(t, st); a == 0 && n == 0 {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	a, n := pending(t, st)
+	t.Fatalf("consumer not settled: %d awaiting ack, %d pending", a, n)
+}
+
+func TestJetStreamAcksAfterPublish(t *testing.T) {
+	url := runServer(t)
+	js, st := jetStream(t, url)
+
+	release := make(chan struct{})
+	pub := newPublisher(func(n int) error {
+		if n == 1 {
+			<-release
+		}
+		return nil
+	})
+	c := New(Options{URL: url, Subject: "orders.>", Stream: "ORDERS", Durable: "api"}, decoder())
+	if !c.AcksAfterPublish() {
+		t.Fatal("JetStream consumers must ack after publish")
+	}
+	start(t, c, pub)
+	if _, err := js.Publish(context.Background(), "orders.paid", []byte(`{"id":"e1","orderId":"o1"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// While Publish is blocked, the message is delivered but not acked.
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if a, _ := pending(t, st); a == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("message never delivered")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	close(release)
+	pub.wait(t, 1)
+	waitSettled(t, st)
+}
+
+func TestJetStreamNaksFailedPublish(t *testing.T) {
+	url := runServer(t)
+	js, st := jetStream(t, url)
+
+	pub := newPublisher(func(n int) error {
+		if n == 1 {
+			return errors.New("log unavailable")
+		}
+		return nil
+	})
+	start(t, New(Options{URL: url, Subject: "orders.>", Stream: "ORDERS", Durable: "api"}, decoder()), pub)
+	if _, err := js.Publish(context.Background(), "orders.paid", []byte(`{"id":"e1","orderId":"o1"}`)); err != nil {
+		t.Fatal(err)
+	}
+	pub.wait(t, 2)
+	waitSettled(t, st)
+	if ids := pub.ids(); len(ids) != 1 || ids[0] != "e1" {
+		t.Fatalf("got %v, want e1 once after redelivery", ids)
+	}
+}
+
+func TestJetStreamTerminatesUndecodable(t *testing.T) {
+	url := runServer(t)
+	js, st := jetStream(t, url)
+
+	pub := newPublisher(nil)
+	start(t, New(Options{URL: url, Subject: "orders.>", Stream: "ORDERS", Durable: "api"}, decoder()), pub)
+	for _, body := range []string{`not json`, `{"id":"e2","orderId":"o2"}`} {
+		if _, err := js.Publish(context.Background(), "orders.paid", []byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pub.wait(t, 1)
+	waitSettled(t, st)
+	if ids := pub.ids(); len(ids) != 1 || ids[0] != "e2" {
+		t.Fatalf("got %v", ids)
+	}
+}
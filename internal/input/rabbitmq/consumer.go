@@ -2,26 +2,23 @@ package rabbitmq
 
 import (
 	"context"
-	"encoding/json"
-	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/rs/zerolog/log"
-	"orderpulse-api/internal/models"
-	"orderpulse-api/internal/stream"
+	"orderpulse-api/internal/input"
 )
 
 type Consumer struct {
 	url   string
 	queue string
-	hub   *stream.Hub
+	dec   *input.Decoder
 }
 
-func New(url, queue string, hub *stream.Hub) *Consumer {
-	return &Consumer{url: url, queue: queue, hub: hub}
+func New(url, queue string, dec *input.Decoder) *Consumer {
+	return &Consumer{url: url, queue: queue, dec: dec}
 }
 
-func (c *Consumer) Run(ctx context.Context) error {
+func (c *Consumer) Run(ctx context.Context, pub input.Publisher) error {
 	conn, err := amqp.Dial(c.url)
 	if err != nil {
 		return err
@@ -47,15 +44,12 @@ func (c *Consumer) Run(ctx context.Context) error {
 			if !ok {
 				return nil
 			}
-			ev := models.OrderEvent{}
-			if err := json.Unmarshal(m.Body, &ev); err != nil {
+			ev, err := c.dec.Decode(ctx, m.ContentType, m.Body)
+			if err != nil {
 				log.Warn().Err(err).Msg("amqp decode")
 				continue
 			}
-			if ev.TS.IsZero() {
-				ev.TS = time.Now().UTC()
-			}
-			c.hub.Publish(ev)
+			_ = pub.Publish(ev)
 		}
 	}
 }
@@ -0,0 +1,176 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/input"
+)
+
+type Options struct {
+	Addr     string
+	Password string
+	DB       int
+	Streams  []string
+	Group    string
+	Consumer string
+	// Field holds the encoded event; an optional "content-type" field picks
+	// the codec.
+	Field string
+	// ClaimIdle is how long an entry may sit unacked in another consumer's
+	// pending list before XAUTOCLAIM takes it over.
+	ClaimIdle time.Duration
+	Block     time.Duration
+	Count     int64
+}
+
+type Consumer struct {
+	opts   Options
+	client *redis.Client
+	dec    *input.Decoder
+}
+
+func New(opts Options, dec *input.Decoder) *Consumer {
+	if opts.Consumer == "" {
+		opts.Consumer, _ = os.Hostname()
+	}
+	if opts.Field == "" {
+		opts.Field = "data"
+	}
+	if opts.ClaimIdle <= 0 {
+		opts.ClaimIdle = time.Minute
+	}
+	if opts.Block <= 0 {
+		opts.Block = 5 * time.Second
+	}
+	if opts.Count <= 0 {
+		opts.Count = 64
+	}
+	return &Consumer{opts: opts, dec: dec}
+}
+
+func (c *Consumer) Run(ctx context.Context, pub input.Publisher) error {
+	c.client = redis.NewClient(&redis.Options{Addr: c.opts.Addr, Password: c.opts.Password, DB: c.opts.DB})
+	defer c.client.Close()
+	if len(c.opts.Streams) == 0 {
+		return errors.New("redis: no streams configured")
+	}
+	for _, s := range c.opts.Streams {
+		err := c.client.XGroupCreateMkStream(ctx, s, c.opts.Group, "0").Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+
+	// Entries this consumer read but never acked before a restart.
+	if err := c.read(ctx, "0", pub); err != nil {
+		return err
+	}
+
+	claim := time.NewTicker(c.opts.ClaimIdle / 2)
+	defer claim.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-claim.C:
+			if err := c.reclaim(ctx, pub); err != nil {
+				return err
+			}
+		default:
+		}
+		if err := c.read(ctx, ">", pub); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Consumer) read(ctx context.Context, id string, pub input.Publisher) error {
+	args := make([]string, 0, 2*len(c.opts.Streams))
+	args = append(args, c.opts.Streams...)
+	for range c.opts.Streams {
+		args = append(args, id)
+	}
+	block := c.opts.Block
+	if id != ">" {
+		block = -1
+	}
+	res, err := c.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    c.opts.Group,
+		Consumer: c.opts.Consumer,
+		Streams:  args,
+		Count:    c.opts.Count,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+	for _, s := range res {
+		for _, m := range s.Messages {
+			c.handle(ctx, s.Stream, m, pub)
+		}
+	}
+	return nil
+}
+
+func (c *Consumer) reclaim(ctx context.Context, pub input.Publisher) error {
+	for _, s := range c.opts.Streams {
+		start := "0-0"
+		for {
+			msgs, next, err := c.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+				Stream:   s,
+				Group:    c.opts.Group,
+				Consumer: c.opts.Consumer,
+				MinIdle:  c.opts.ClaimIdle,
+				Start:    start,
+				Count:    c.opts.Count,
+			}).Result()
+			if err != nil {
+				return err
+			}
+			if len(msgs) > 0 {
+				log.Info().Str("stream", s).Int("n", len(msgs)).Msg("redis reclaimed")
+			}
+			for _, m := range msgs {
+				c.handle(ctx, s, m, pub)
+			}
+			if next == "0-0" || next == "" {
+				break
+			}
+			start = next
+		}
+	}
+	return nil
+}
+
+// AcksAfterPublish implements input.Acker: entries are XACKed once Publish
+// returns.
+func (c *Consumer) AcksAfterPublish() bool { return true }
+
+// handle acks only once the event is durably appended; a failed append leaves
+// the entry pending so it is retried through reclaim.
+func (c *Consumer) handle(ctx context.Context, streamKey string, m redis.XMessage, pub input.Publisher) {
+	raw, _ := m.Values[c.opts.Field].(string)
+	ct, _ := m.Values["content-type"].(string)
+	ev, err := c.dec.Decode(ctx, ct, []byte(raw))
+	if err != nil {
+		log.Warn().Err(err).Str("id", m.ID).Msg("redis decode")
+	} else if err := pub.Publish(ev); err != nil {
+		log.Error().Err(err).Str("id", m.ID).Msg("redis append")
+		return
+	}
+	if err := c.client.XAck(ctx, streamKey, c.opts.Group, m.ID).Err(); err != nil {
+		log.Warn().Err(err).Str("id", m.ID).Msg("redis ack")
+	}
+}
@@ -0,0 +1,175 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"orderpulse-api/internal/codec"
+	"orderpulse-api/internal/input"
+	"orderpulse-api/internal/models"
+)
+
+// publisher records event IDs and answers Publish with whatever fail
+// returns for the nth call.
+type publisher struct {
+	mu    sync.Mutex
+	ids   []string
+	calls int
+	fail  func(n int) error
+}
+
+func (p *publisher) Publish(ev models.OrderEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls++
+	if p.fail != nil {
+		if err := p.fail(p.calls); err != nil {
+			return err
+		}
+	}
+	p.ids = append(p.ids, ev.ID)
+	return nil
+}
+
+func (p *publisher) published() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.ids...)
+}
+
+func setup(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	rc := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { _ = rc.Close() })
+	return mr, rc
+}
+
+func add(t *testing.T, rc *redis.Client, id string) {
+	t.Helper()
+	err := rc.XAdd(context.Background(), &redis.XAddArgs{
+		Stream: "orders",
+		Values: map[string]any{"data": `{"id":"` + id + `","orderId":"o-` + id + `"}`},
+	}).Err()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func start(t *testing.T, addr string, opts Options, pub input.Publisher) {
+	opts.Addr, opts.Streams, opts.Group = addr, []string{"orders"}, "api"
+	opts.Block = 50 * time.Millisecond
+	c := New(opts, input.NewDecoder("redis", codec.NewSet(nil), codec.JSON))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = c.Run(ctx, pub)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+}
+
+// eventually polls cond for up to five seconds.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func pendingCount(rc *redis.Client) int64 {
+	p, err := rc.XPending(context.Background(), "orders", "api").Result()
+	if err != nil {
+		return -1
+	}
+	return p.Count
+}
+
+func TestReadsAndAcks(t *testing.T) {
+	mr, rc := setup(t)
+	pub := &publisher{}
+	start(t, mr.Addr(), Options{Consumer: "api-1"}, pub)
+
+	add(t, rc, "e1")
+	add(t, rc, "e2")
+	eventually(t, "two events", func() bool { return len(pub.published()) == 2 })
+	eventually(t, "acks", func() bool { return pendingCount(rc) == 0 })
+}
+
+func TestDropsUndecodable(t *testing.T) {
+	mr, rc := setup(t)
+	pub := &publisher{}
+	start(t, mr.Addr(), Options{Consumer: "api-1"}, pub)
+
+	if err := rc.XAdd(context.Background(), &redis.XAddArgs{Stream: "orders", Values: map[string]any{"data": "not json"}}).Err(); err != nil {
+		t.Fatal(err)
+	}
+	add(t, rc, "e1")
+	eventually(t, "e1", func() bool { return len(pub.published()) == 1 })
+	eventually(t, "acks", func() bool { return pendingCount(rc) == 0 })
+}
+
+func TestResumesOwnPendingEntries(t *testing.T) {
+	mr, rc := setup(t)
+	ctx := context.Background()
+	if err := rc.XGroupCreateMkStream(ctx, "orders", "api", "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	add(t, rc, "e1")
+	// A previous run of api-1 read e1 and died before acking it.
+	if err := rc.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "api", Consumer: "api-1", Streams: []string{"orders", ">"}}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	pub := &publisher{}
+	start(t, mr.Addr(), Options{Consumer: "api-1", ClaimIdle: time.Hour}, pub)
+	eventually(t, "e1", func() bool { return len(pub.published()) == 1 })
+	eventually(t, "acks", func() bool { return pendingCount(rc) == 0 })
+}
+
+func TestReclaimsFromDeadConsumer(t *testing.T) {
+	mr, rc := setup(t)
+	ctx := context.Background()
+	if err := rc.XGroupCreateMkStream(ctx, "orders", "api", "0").Err(); err != nil {
+		t.Fatal(err)
+	}
+	add(t, rc, "e1")
+	if err := rc.XReadGroup(ctx, &redis.XReadGroupArgs{Group: "api", Consumer: "dead", Streams: []string{"orders", ">"}}).Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	pub := &publisher{}
+	start(t, mr.Addr(), Options{Consumer: "api-1", ClaimIdle: 200 * time.Millisecond}, pub)
+	eventually(t, "reclaimed e1", func() bool { return len(pub.published()) == 1 })
+	eventually(t, "acks", func() bool { return pendingCount(rc) == 0 })
+	if ids := pub.published(); ids[0] != "e1" {
+		t.Fatalf("got %v", ids)
+	}
+}
+
+func TestFailedPublishStaysPendingUntilReclaimed(t *testing.T) {
+	mr, rc := setup(t)
+	pub := &publisher{fail: func(n int) error {
+		if n == 1 {
+			return errors.New("log unavailable")
+		}
+		return nil
+	}}
+	start(t, mr.Addr(), Options{Consumer: "api-1", ClaimIdle: 200 * time.Millisecond}, pub)
+
+	add(t, rc, "e1")
+	eventually(t, "retried e1", func() bool { return len(pub.published()) == 1 })
+	eventually(t, "acks", func() bool { return pendingCount(rc) == 0 })
+}
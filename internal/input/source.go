@@ -0,0 +1,41 @@
+package input
+
+import (
+	"context"
+
+	"orderpulse-api/internal/models"
+)
+
+// Publisher is where inputs hand off decoded events; *stream.Hub satisfies it
+// and the supervisor wraps it per source.
+type Publisher interface {
+	Publish(models.OrderEvent) error
+}
+
+// Source is a long-running input. Run blocks until ctx is cancelled or the
+// source fails; the supervisor restarts it on any return before shutdown.
+type Source interface {
+	Run(ctx context.Context, pub Publisher) error
+}
+
+// DurablePublisher is implemented by publishers that can wait until an
+// event is committed to the log, as *stream.Hub does.
+type DurablePublisher interface {
+	PublishDurable(models.OrderEvent) error
+}
+
+// Acker is implemented by sources that acknowledge upstream (a broker ack,
+// a saved offset, a moved file) as soon as Publish returns. The supervisor
+// publishes their events with PublishDurable, so the ack never precedes the
+// log commit whatever LOG_PERSIST says.
+type Acker interface {
+	AcksAfterPublish() bool
+}
+
+type SourceFunc func(ctx context.Context, pub Publisher) error
+
+func (f SourceFunc) Run(ctx context.Context, pub Publisher) error { return f(ctx, pub) }
+
+// Middleware wraps the publisher handed to a named source, e.g. to drop
+// duplicates or run processors before the hub.
+type Middleware func(source string, next Publisher) Publisher
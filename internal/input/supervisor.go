@@ -0,0 +1,335 @@
+package input
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/models"
+)
+
+type State string
+
+const (
+	StateStarting  State = "starting"
+	StateRunning   State = "running"
+	StateBackoff   State = "backing_off"
+	StateFailed    State = "failed"
+	StateStopped   State = "stopped"
+	StateStandby   State = "standby"
+	backoffInitial       = 500 * time.Millisecond
+	// stableAfter resets the backoff once a source has run this long.
+	stableAfter = time.Minute
+)
+
+var allStates = []State{StateStarting, StateRunning, StateBackoff, StateFailed, StateStopped, StateStandby}
+
+var (
+	stateGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "input_source_state",
+		Help: "1 for the current state of each input source",
+	}, []string{"source", "state"})
+	eventsCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "input_events_total",
+		Help: "events published per input source",
+	}, []string{"source"})
+	restartsCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "input_restarts_total",
+		Help: "input source restarts",
+	}, []string{"source"})
+)
+
+func init() { prometheus.MustRegister(stateGauge, eventsCtr, restartsCtr) }
+
+type Status struct {
+	Name        string    `json:"name"`
+	State       State     `json:"state"`
+	Since       time.Time `json:"since"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastErrorAt time.Time `json:"lastErrorAt,omitzero"`
+	Restarts    int       `json:"restarts"`
+	Events      uint64    `json:"events"`
+}
+
+// Gate holds sources back while this instance may not run them, e.g. while
+// another replica is the leader.
+type Gate interface {
+	// Open reports whether gated sources may run now, and returns a channel
+	// that is closed at the next change.
+	Open() (bool, <-chan struct{})
+}
+
+type entry struct {
+	name   string
+	src    Source
+	gate   Gate
+	acks   bool
+	cancel context.CancelFunc
+	done   chan struct{}
+	events atomic.Uint64
+
+	mu     sync.Mutex
+	status Status
+}
+
+func (e *entry) set(st State, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.status.State != st {
+		stateGauge.WithLabelValues(e.name, string(e.status.State)).Set(0)
+		stateGauge.WithLabelValues(e.name, string(st)).Set(1)
+		e.status.State = st
+		e.status.Since = time.Now().UTC()
+	}
+	if err != nil {
+		e.status.LastError = err.Error()
+		e.status.LastErrorAt = time.Now().UTC()
+	}
+}
+
+// Supervisor runs input sources, restarts them with exponential backoff and
+// stops them in reverse registration order on shutdown.
+type Supervisor struct {
+	pub         Publisher
+	mws         []Middleware
+	backoffMax  time.Duration
+	maxFailures int
+
+	mu      sync.Mutex
+	entries []*entry
+}
+
+// NewSupervisor publishes into pub. A source that fails maxFailures times in
+// a row without a stable run is marked failed and left stopped; 0 retries
+// forever.
+func NewSupervisor(pub Publisher, backoffMax time.Duration, maxFailures int) *Supervisor {
+	if backoffMax < backoffInitial {
+		backoffMax = backoffInitial
+	}
+	return &Supervisor{pub: pub, backoffMax: backoffMax, maxFailures: maxFailures}
+}
+
+// Use appends middleware applied, in order, to every source's publisher.
+// It must be called before Start and Publisher.
+func (s *Supervisor) Use(mws ...Middleware) {
+	s.mws = append(s.mws, mws...)
+}
+
+func (s *Supervisor) publisher(e *entry) Publisher {
+	var pub Publisher = countingPublisher{next: s.pub, e: e}
+	for i := len(s.mws) - 1; i >= 0; i-- {
+		pub = s.mws[i](e.name, pub)
+	}
+	return pub
+}
+
+// Publisher registers a passive source, one driven from outside such as an
+// HTTP handler, and returns its publisher. It always reports running.
+func (s *Supervisor) Publisher(name string) Publisher { return s.passive(name, false) }
+
+// AckingPublisher is Publisher for a passive source that acknowledges its
+// caller once Publish returns, as a webhook's 2xx does: like an Acker's,
+// its events are published with PublishDurable.
+func (s *Supervisor) AckingPublisher(name string) Publisher { return s.passive(name, true) }
+
+func (s *Supervisor) passive(name string, acks bool) Publisher {
+	s.Add(name, nil)
+	s.mu.Lock()
+	e := s.entries[len(s.entries)-1]
+	s.mu.Unlock()
+	e.acks = acks
+	e.set(StateRunning, nil)
+	return s.publisher(e)
+}
+
+func (s *Supervisor) Add(name string, src Source) {
+	s.AddGated(name, src, nil)
+}
+
+// AddGated registers a source that only runs while g is open; it is
+// cancelled, without counting as a failure, when g closes.
+func (s *Supervisor) AddGated(name string, src Source, g Gate) {
+	e := &entry{name: name, src: src, gate: g, status: Status{Name: name}}
+	if a, ok := src.(Acker); ok {
+		e.acks = a.AcksAfterPublish()
+	}
+	for _, st := range allStates {
+		stateGauge.WithLabelValues(name, string(st)).Set(0)
+	}
+	e.set(StateStopped, nil)
+	s.mu.Lock()
+	s.entries = append(s.entries, e)
+	s.mu.Unlock()
+}
+
+func (s *Supervisor) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.entries {
+		if e.done != nil || e.src == nil {
+			continue
+		}
+		sctx, cancel := context.WithCancel(ctx)
+		e.cancel, e.done = cancel, make(chan struct{})
+		go s.loop(sctx, e)
+	}
+}
+
+func (s *Supervisor) loop(ctx context.Context, e *entry) {
+	defer close(e.done)
+	pub := s.publisher(e)
+	backoff := backoffInitial
+	failures := 0
+	for {
+		runCtx, stop := ctx, context.CancelFunc(func() {})
+		if e.gate != nil {
+			if !waitGate(ctx, e) {
+				e.set(StateStopped, nil)
+				return
+			}
+			runCtx, stop = context.WithCancel(ctx)
+			go watchGate(runCtx, e.gate, stop)
+		}
+		e.set(StateRunning, nil)
+		log.Info().Str("source", e.name).Msg("input start")
+		started := time.Now()
+		err := e.src.Run(runCtx, pub)
+		stop()
+		if ctx.Err() != nil {
+			e.set(StateStopped, nil)
+			return
+		}
+		if e.gate != nil {
+			if open, _ := e.gate.Open(); !open {
+				log.Info().Str("source", e.name).Msg("input standby")
+				continue
+			}
+		}
+		if err == nil {
+			err = errors.New("source exited")
+		}
+		if time.Since(started) > stableAfter {
+			backoff, failures = backoffInitial, 0
+		}
+		failures++
+		if s.maxFailures > 0 && failures >= s.maxFailures {
+			log.Error().Err(err).Str("source", e.name).Int("failures", failures).Msg("input failed")
+			e.set(StateFailed, err)
+			return
+		}
+		log.Warn().Err(err).Str("source", e.name).Dur("backoff", backoff).Msg("input restart")
+		e.set(StateBackoff, err)
+		select {
+		case <-ctx.Done():
+			e.set(StateStopped, nil)
+			return
+		case <-time.After(backoff):
+		}
+		e.mu.Lock()
+		e.status.Restarts++
+		e.mu.Unlock()
+		restartsCtr.WithLabelValues(e.name).Inc()
+		backoff = min(backoff*2, s.backoffMax)
+	}
+}
+
+// waitGate parks e in standby until its gate opens; false if ctx ends first.
+func waitGate(ctx context.Context, e *entry) bool {
+	for {
+		open, changed := e.gate.Open()
+		if open {
+			return true
+		}
+		e.set(StateStandby, nil)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// watchGate cancels a running source when its gate closes.
+func watchGate(ctx context.Context, g Gate, cancel context.CancelFunc) {
+	for {
+		open, changed := g.Open()
+		if !open {
+			cancel()
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-changed:
+		}
+	}
+}
+
+// Stop cancels sources one at a time, last registered first, waiting up to
+// timeout overall.
+func (s *Supervisor) Stop(timeout time.Duration) {
+	deadline := time.After(timeout)
+	s.mu.Lock()
+	entries := append([]*entry(nil), s.entries...)
+	s.mu.Unlock()
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if e.done == nil {
+			continue
+		}
+		e.cancel()
+		select {
+		case <-e.done:
+		case <-deadline:
+			log.Warn().Str("source", e.name).Msg("input stop timed out")
+			return
+		}
+	}
+}
+
+func (s *Supervisor) Status() []Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Status, 0, len(s.entries))
+	for _, e := range s.entries {
+		e.mu.Lock()
+		st := e.status
+		e.mu.Unlock()
+		st.Events = e.events.Load()
+		out = append(out, st)
+	}
+	return out
+}
+
+// Ready fails when any source has given up.
+func (s *Supervisor) Ready() error {
+	for _, st := range s.Status() {
+		if st.State == StateFailed {
+			return fmt.Errorf("input %s failed: %s", st.Name, st.LastError)
+		}
+	}
+	return nil
+}
+
+type countingPublisher struct {
+	next Publisher
+	e    *entry
+}
+
+func (p countingPublisher) Publish(ev models.OrderEvent) error {
+	publish := p.next.Publish
+	if d, ok := p.next.(DurablePublisher); ok && p.e.acks {
+		publish = d.PublishDurable
+	}
+	if err := publish(ev); err != nil {
+		return err
+	}
+	p.e.events.Add(1)
+	eventsCtr.WithLabelValues(p.e.name).Inc()
+	return nil
+}
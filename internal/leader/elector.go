@@ -0,0 +1,145 @@
+package leader
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	leaderGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "leader_is_leader",
+		Help: "1 while this instance holds the leader lease",
+	})
+	transitionsCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "leader_transitions_total",
+		Help: "leadership gained or lost",
+	}, []string{"to"})
+	lockErrCtr = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "leader_lock_errors_total",
+		Help: "failed lease acquire or renew attempts",
+	})
+)
+
+func init() { prometheus.MustRegister(leaderGauge, transitionsCtr, lockErrCtr) }
+
+// Lock is a lease held by at most one instance.
+type Lock interface {
+	// Acquire takes the lease, or renews it when already held, for ttl.
+	Acquire(ctx context.Context, ttl time.Duration) (bool, error)
+	Release(ctx context.Context) error
+}
+
+type Status struct {
+	Node   string    `json:"node"`
+	Leader bool      `json:"leader"`
+	Since  time.Time `json:"since"`
+}
+
+// Elector keeps trying to hold lock. The leader renews every ttl/3 and steps
+// down once ttl minus one renew interval has passed since the start of its
+// last successful renew, so it stops before the lease can expire and
+// another instance take over; standbys retry every ttl/3 (at most every
+// second), so failover after a crash takes about ttl and after a clean
+// shutdown about one retry.
+type Elector struct {
+	node string
+	lock Lock
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	leader  bool
+	since   time.Time
+	changed chan struct{}
+}
+
+// New fails for a ttl too short to leave a renew interval, which would make
+// Run spin and step down as soon as it leads.
+func New(node string, lock Lock, ttl time.Duration) (*Elector, error) {
+	if ttl/3 <= 0 {
+		return nil, fmt.Errorf("leader: ttl %v too short", ttl)
+	}
+	return &Elector{node: node, lock: lock, ttl: ttl, since: time.Now().UTC(), changed: make(chan struct{})}, nil
+}
+
+// Open implements input.Gate.
+func (e *Elector) Open() (bool, <-chan struct{}) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader, e.changed
+}
+
+func (e *Elector) Status() Status {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return Status{Node: e.node, Leader: e.leader, Since: e.since}
+}
+
+func (e *Elector) set(leader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.leader == leader {
+		return
+	}
+	e.leader, e.since = leader, time.Now().UTC()
+	close(e.changed)
+	e.changed = make(chan struct{})
+	if leader {
+		leaderGauge.Set(1)
+		transitionsCtr.WithLabelValues("leader").Inc()
+		log.Info().Str("node", e.node).Msg("became leader")
+	} else {
+		leaderGauge.Set(0)
+		transitionsCtr.WithLabelValues("standby").Inc()
+		log.Warn().Str("node", e.node).Msg("lost leadership")
+	}
+}
+
+// Run campaigns until ctx is done, then releases the lease if held.
+func (e *Elector) Run(ctx context.Context) {
+	renew := e.ttl / 3
+	retry := min(renew, time.Second)
+	var lastOK time.Time
+	for {
+		// The lease runs from some point after start, so start bounds its
+		// expiry from below.
+		start := time.Now()
+		actx, cancel := context.WithTimeout(ctx, renew)
+		ok, err := e.lock.Acquire(actx, e.ttl)
+		cancel()
+		switch {
+		case err != nil:
+			lockErrCtr.Inc()
+			log.Warn().Err(err).Msg("leader lease")
+			// The lease may still be ours on the server, but step down
+			// while there is a renew interval of margin before it expires.
+			if time.Since(lastOK) >= e.ttl-renew {
+				e.set(false)
+			}
+		case ok:
+			lastOK = start
+			e.set(true)
+		default:
+			e.set(false)
+		}
+		wait := retry
+		if e.Status().Leader {
+			wait = renew
+		}
+		select {
+		case <-ctx.Done():
+			e.set(false)
+			rctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			if err := e.lock.Release(rctx); err != nil {
+				log.Warn().Err(err).Msg("leader release")
+			}
+			cancel()
+			return
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memLease is an in-memory lease server shared by several memLocks.
+type memLease struct {
+	mu      sync.Mutex
+	holder  string
+	expires time.Time
+}
+
+// memLock is one client of a memLease; down makes its calls fail, as if
+// the lease server were unreachable.
+type memLock struct {
+	lease *memLease
+	name  string
+
+	mu   sync.Mutex
+	down bool
+}
+
+func (l *memLock) setDown(down bool) {
+	l.mu.Lock()
+	l.down = down
+	l.mu.Unlock()
+}
+
+func (l *memLock) Acquire(_ context.Context, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.down {
+		return false, errors.New("lease server unreachable")
+	}
+	s := l.lease
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder != "" && s.holder != l.name && time.Now().Before(s.expires) {
+		return false, nil
+	}
+	s.holder, s.expires = l.name, time.Now().Add(ttl)
+	return true, nil
+}
+
+func (l *memLock) Release(context.Context) error {
+	s := l.lease
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holder == l.name {
+		s.holder = ""
+	}
+	return nil
+}
+
+func (s *memLease) expiry() (string, time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.holder, s.expires
+}
+
+func newElector(t *testing.T, node string, lock Lock, ttl time.Duration) *Elector {
+	t.Helper()
+	e, err := New(node, lock, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func run(t *testing.T, e *Elector) context.CancelFunc {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx)
+	}()
+	stop := func() {
+		cancel()
+		<-done
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
+// waitFor blocks until e's leadership is want, using the Gate channel.
+func waitFor(t *testing.T, e *Elector, want bool, within time.Duration) {
+	t.Helper()
+	deadline := time.After(within)
+	for {
+		open, changed := e.Open()
+		if open == want {
+			return
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("%s: leader=%v after %v, want %v", e.node, open, within, want)
+		}
+	}
+}
+
+func TestSingleLeaderAndCleanFailover(t *testing.T) {
+	lease := &memLease{}
+	ttl := 600 * time.Millisecond
+	a := newElector(t, "a", &memLock{lease: lease, name: "a"}, ttl)
+	b := newElector(t, "b", &memLock{lease: lease, name: "b"}, ttl)
+	stopA := run(t, a)
+	waitFor(t, a, true, time.Second)
+	run(t, b)
+
+	time.Sleep(ttl)
+	if b.Status().Leader {
+		t.Fatal("both instances lead")
+	}
+	// A clean shutdown releases the lease, so b takes over within a retry
+	// rather than waiting for the TTL.
+	stopA()
+	waitFor(t, b, true, 400*time.Millisecond)
+	if a.Status().Leader {
+		t.Fatal("stopped elector still reports leader")
+	}
+}
+
+func TestStepsDownBeforeLeaseExpires(t *testing.T) {
+	lease := &memLease{}
+	ttl := 600 * time.Millisecond
+	lock := &memLock{lease: lease, name: "a"}
+	a := newElector(t, "a", lock, ttl)
+	run(t, a)
+	waitFor(t, a, true, time.Second)
+
+	lock.setDown(true)
+	waitFor(t, a, false, 2*ttl)
+	// The lease server still holds the lease for a; it must not have
+	// expired yet, or another instance could already be leading.
+	holder, expires := lease.expiry()
+	if holder != "a" {
+		t.Fatalf("holder %q", holder)
+	}
+	if left := time.Until(expires); left <= 0 {
+		t.Fatalf("stepped down %v after the lease expired", -left)
+	}
+
+	lock.setDown(false)
+	waitFor(t, a, true, time.Second)
+}
+
+func TestStandbyTakesOverAfterCrash(t *testing.T) {
+	lease := &memLease{}
+	ttl := 600 * time.Millisecond
+	// a held the lease and vanished without releasing it.
+	if ok, _ := (&memLock{lease: lease, name: "a"}).Acquire(context.Background(), ttl); !ok {
+		t.Fatal("seed acquire failed")
+	}
+	b := newElector(t, "b", &memLock{lease: lease, name: "b"}, ttl)
+	run(t, b)
+	if b.Status().Leader {
+		t.Fatal("b led while a's lease was live")
+	}
+	waitFor(t, b, true, 2*ttl)
+}
+
+func TestRejectsTTLTooShortToRenew(t *testing.T) {
+	for _, ttl := range []time.Duration{-time.Second, 0, 2} {
+		if _, err := New("a", &memLock{lease: &memLease{}, name: "a"}, ttl); err == nil {
+			t.Errorf("ttl %v accepted", ttl)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+//go:build unix
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FileLock is an flock(2) on a shared file, for replicas on one host. The
+// kernel drops it when the process dies, so it needs no renewal.
+type FileLock struct {
+	path string
+	node string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+func NewFileLock(path, node string) (*FileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return &FileLock{path: path, node: node}, nil
+}
+
+func (l *FileLock) Acquire(context.Context, time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		return true, nil
+	}
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return false, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return false, nil
+		}
+		return false, err
+	}
+	// Record the holder for operators; readers must not rely on it.
+	_ = f.Truncate(0)
+	_, _ = f.WriteAt([]byte(l.node+" "+strconv.Itoa(os.Getpid())+"\n"), 0)
+	l.f = f
+	return true, nil
+}
+
+func (l *FileLock) Release(context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	_ = syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package leader
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var errNoFlock = errors.New("file leader lock needs a unix system")
+
+type FileLock struct{}
+
+func NewFileLock(path, node string) (*FileLock, error) { return nil, errNoFlock }
+
+func (*FileLock) Acquire(context.Context, time.Duration) (bool, error) { return false, errNoFlock }
+func (*FileLock) Release(context.Context) error                        { return nil }
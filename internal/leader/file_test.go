@@ -0,0 +1,36 @@
+//go:build unix
+
+package leader
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.lock")
+	ctx := context.Background()
+	a, err := NewFileLock(path, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewFileLock(path, "b")
+
+	if ok, err := a.Acquire(ctx, 0); !ok || err != nil {
+		t.Fatalf("a acquire: %v, %v", ok, err)
+	}
+	if ok, err := b.Acquire(ctx, 0); ok || err != nil {
+		t.Fatalf("b acquired a held lock: %v, %v", ok, err)
+	}
+	if ok, _ := a.Acquire(ctx, 0); !ok {
+		t.Fatal("a could not renew")
+	}
+	if err := a.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := b.Acquire(ctx, 0); !ok {
+		t.Fatal("b could not take a released lock")
+	}
+	_ = b.Release(ctx)
+}
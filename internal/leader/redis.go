@@ -0,0 +1,59 @@
+package leader
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	acquireScript = redis.NewScript(`
+local v = redis.call('GET', KEYS[1])
+if v == ARGV[1] then
+  redis.call('PEXPIRE', KEYS[1], ARGV[2])
+  return 1
+end
+if not v then
+  redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+  return 1
+end
+return 0`)
+	releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+  return redis.call('DEL', KEYS[1])
+end
+return 0`)
+)
+
+// RedisLease is a lease stored as key = token with a TTL; only the holder
+// can renew or release it. The token is the node name plus a random suffix
+// per process, so two replicas never share it even with the same node name.
+type RedisLease struct {
+	client *redis.Client
+	key    string
+	token  string
+}
+
+func NewRedisLease(addr, password, key, node string) *RedisLease {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return &RedisLease{
+		client: redis.NewClient(&redis.Options{Addr: addr, Password: password}),
+		key:    key,
+		token:  node + "/" + hex.EncodeToString(b),
+	}
+}
+
+func (l *RedisLease) Acquire(ctx context.Context, ttl time.Duration) (bool, error) {
+	n, err := acquireScript.Run(ctx, l.client, []string{l.key}, l.token, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (l *RedisLease) Release(ctx context.Context) error {
+	return releaseScript.Run(ctx, l.client, []string{l.key}, l.token).Err()
+}
+
+func (l *RedisLease) Close() error { return l.client.Close() }
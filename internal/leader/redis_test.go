@@ -0,0 +1,49 @@
+package leader
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisLease(t *testing.T) {
+	mr := miniredis.RunT(t)
+	ctx := context.Background()
+	// Same node name on purpose: the per-process token keeps them apart.
+	a := NewRedisLease(mr.Addr(), "", "orderpulse:leader", "node")
+	b := NewRedisLease(mr.Addr(), "", "orderpulse:leader", "node")
+	t.Cleanup(func() { _ = a.Close(); _ = b.Close() })
+
+	if ok, err := a.Acquire(ctx, 10*time.Second); !ok || err != nil {
+		t.Fatalf("a acquire: %v, %v", ok, err)
+	}
+	if ok, err := b.Acquire(ctx, 10*time.Second); ok || err != nil {
+		t.Fatalf("b acquired a held lease: %v, %v", ok, err)
+	}
+	if ok, _ := a.Acquire(ctx, 10*time.Second); !ok {
+		t.Fatal("a could not renew")
+	}
+	// Releasing a lease someone else holds is a no-op.
+	if err := b.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := b.Acquire(ctx, 10*time.Second); ok {
+		t.Fatal("b's release dropped a's lease")
+	}
+
+	mr.FastForward(11 * time.Second)
+	if ok, _ := b.Acquire(ctx, 10*time.Second); !ok {
+		t.Fatal("b could not take an expired lease")
+	}
+	if ok, _ := a.Acquire(ctx, 10*time.Second); ok {
+		t.Fatal("a renewed a lease it lost")
+	}
+	if err := b.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := a.Acquire(ctx, 10*time.Second); !ok {
+		t.Fatal("a could not take a released lease")
+	}
+}
@@ -2,6 +2,7 @@ package logstore
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"os"
 	"path/filepath"
@@ -17,11 +18,19 @@ type Store interface {
 	Health() error
 }
 
+// Batcher is implemented by stores that can write several events at once.
+type Batcher interface {
+	AppendBatch([]models.OrderEvent) error
+}
+
 type FileStore struct {
 	path        string
 	maxBytes    int64
 	retention   time.Duration
+	sync        bool
 	mu          sync.Mutex
+	f           *os.File
+	size        int64
 	lastPruneAt time.Time
 }
 
@@ -29,31 +38,53 @@ func NewFileStore(path string, maxBytes int64, retention time.Duration) (*FileSt
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return nil, err
 	}
-	f, err := os.OpenFile(path, os.O_CREATE, 0o644)
-	if err == nil {
-		_ = f.Close()
-	}
-	return &FileStore{path: path, maxBytes: maxBytes, retention: retention}, err
+	s := &FileStore{path: path, maxBytes: maxBytes, retention: retention}
+	return s, s.open()
 }
 
-func (s *FileStore) Append(ev models.OrderEvent) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// SetSync makes every batch fsync before it is acknowledged.
+func (s *FileStore) SetSync(on bool) { s.sync = on }
 
-	if info, err := os.Stat(s.path); err == nil && info.Size() >= s.maxBytes {
-		ts := time.Now().UTC().Format("20060102T150405")
-		_ = os.Rename(s.path, s.path+"."+ts+".gz")
-		_, _ = os.Create(s.path)
+func (s *FileStore) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
 	}
-
-	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0o644)
+	info, err := f.Stat()
 	if err != nil {
+		f.Close()
 		return err
 	}
-	defer f.Close()
+	s.f, s.size = f, info.Size()
+	return nil
+}
 
-	b, _ := json.Marshal(ev)
-	_, err = f.Write(append(b, '\n'))
+func (s *FileStore) Append(ev models.OrderEvent) error {
+	return s.AppendBatch([]models.OrderEvent{ev})
+}
+
+// AppendBatch writes the events with a single write (and fsync when
+// enabled), rotating first if the file has reached maxBytes.
+func (s *FileStore) AppendBatch(evs []models.OrderEvent) error {
+	var buf bytes.Buffer
+	for _, ev := range evs {
+		b, _ := json.Marshal(ev)
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil || s.size >= s.maxBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(buf.Bytes())
+	s.size += int64(n)
+	if err == nil && s.sync {
+		err = s.f.Sync()
+	}
 
 	if time.Since(s.lastPruneAt) > time.Hour {
 		_ = s.pruneOld()
@@ -62,6 +93,27 @@ func (s *FileStore) Append(ev models.OrderEvent) error {
 	return err
 }
 
+func (s *FileStore) rotate() error {
+	if s.f != nil {
+		_ = s.f.Close()
+		s.f = nil
+		ts := time.Now().UTC().Format("20060102T150405")
+		_ = os.Rename(s.path, s.path+"."+ts+".gz")
+	}
+	return s.open()
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
+
 func (s *FileStore) pruneOld() error {
 	dir := filepath.Dir(s.path)
 	entries, err := os.ReadDir(dir)
@@ -0,0 +1,182 @@
+package logstore
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/models"
+)
+
+var (
+	batchHist = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "logstore_batch_size",
+		Help:    "events per group commit",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	})
+	commitHist = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "logstore_commit_seconds",
+		Help:    "group commit latency",
+		Buckets: prometheus.DefBuckets,
+	})
+	writtenCtr = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logstore_events_written_total",
+		Help: "events persisted",
+	})
+	errorsCtr = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "logstore_write_errors_total",
+		Help: "events whose commit failed",
+	})
+	queueGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "logstore_queue_depth",
+		Help: "events waiting for the writer",
+	})
+)
+
+func init() { prometheus.MustRegister(batchHist, commitHist, writtenCtr, errorsCtr, queueGauge) }
+
+var ErrClosed = errors.New("logstore: writer closed")
+
+type writeReq struct {
+	ev   models.OrderEvent
+	done chan error // nil for Enqueue
+}
+
+// Writer serialises appends through one goroutine. Requests that arrive
+// while a commit is in flight are written together in the next one, so
+// concurrent publishers share a single write (and fsync).
+type Writer struct {
+	store    Store
+	maxBatch int
+	in       chan writeReq
+	stopped  chan struct{}
+
+	mu      sync.RWMutex // guards closed against sends on in
+	closed  bool
+	errMu   sync.Mutex
+	lastErr error
+}
+
+func NewWriter(store Store, queue, maxBatch int) *Writer {
+	if queue <= 0 {
+		queue = 8192
+	}
+	if maxBatch <= 0 {
+		maxBatch = 512
+	}
+	w := &Writer{store: store, maxBatch: maxBatch, in: make(chan writeReq, queue), stopped: make(chan struct{})}
+	go w.run()
+	return w
+}
+
+// Append blocks until ev is committed and returns the commit error.
+func (w *Writer) Append(ev models.OrderEvent) error {
+	done := make(chan error, 1)
+	if err := w.send(writeReq{ev: ev, done: done}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// Enqueue hands ev to the writer without waiting for the commit; failures
+// surface through metrics and Health. It blocks only while the queue is full.
+func (w *Writer) Enqueue(ev models.OrderEvent) error {
+	return w.send(writeReq{ev: ev})
+}
+
+func (w *Writer) send(r writeReq) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrClosed
+	}
+	w.in <- r
+	queueGauge.Set(float64(len(w.in)))
+	return nil
+}
+
+func (w *Writer) run() {
+	defer close(w.stopped)
+	batch := make([]writeReq, 0, w.maxBatch)
+	for r := range w.in {
+		batch = append(batch[:0], r)
+	drain:
+		for len(batch) < w.maxBatch {
+			select {
+			case r, ok := <-w.in:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, r)
+			default:
+				break drain
+			}
+		}
+		queueGauge.Set(float64(len(w.in)))
+		w.commit(batch)
+	}
+}
+
+func (w *Writer) commit(batch []writeReq) {
+	evs := make([]models.OrderEvent, len(batch))
+	for i, r := range batch {
+		evs[i] = r.ev
+	}
+	start := time.Now()
+	var err error
+	if b, ok := w.store.(Batcher); ok {
+		err = b.AppendBatch(evs)
+	} else {
+		for _, ev := range evs {
+			if err = w.store.Append(ev); err != nil {
+				break
+			}
+		}
+	}
+	commitHist.Observe(time.Since(start).Seconds())
+	batchHist.Observe(float64(len(evs)))
+	if err != nil {
+		errorsCtr.Add(float64(len(evs)))
+		log.Error().Err(err).Int("events", len(evs)).Msg("logstore commit")
+	} else {
+		writtenCtr.Add(float64(len(evs)))
+	}
+	w.errMu.Lock()
+	w.lastErr = err
+	w.errMu.Unlock()
+	for _, r := range batch {
+		if r.done != nil {
+			r.done <- err
+		}
+	}
+}
+
+func (w *Writer) ReplaySince(since time.Time, yield func(models.OrderEvent) bool) error {
+	return w.store.ReplaySince(since, yield)
+}
+
+// Health reports the last commit's error, then the store's own health.
+func (w *Writer) Health() error {
+	w.errMu.Lock()
+	err := w.lastErr
+	w.errMu.Unlock()
+	if err != nil {
+		return err
+	}
+	return w.store.Health()
+}
+
+// Close flushes queued events and stops the writer; it does not close the
+// underlying store.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.in)
+	}
+	w.mu.Unlock()
+	<-w.stopped
+	return nil
+}
@@ -0,0 +1,301 @@
+package logstore
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+// fakeStore records the ids of each write. While hold is open every write
+// waits on it, so the test can queue requests behind a commit in flight.
+type fakeStore struct {
+	mu      sync.Mutex
+	writes  [][]string
+	fail    func(ids []string) error
+	hold    chan struct{}
+	started chan struct{}
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{hold: make(chan struct{}), started: make(chan struct{}, 1024)}
+}
+
+func (s *fakeStore) write(evs []models.OrderEvent) error {
+	s.started <- struct{}{}
+	<-s.hold
+	ids := make([]string, len(evs))
+	for i, ev := range evs {
+		ids[i] = ev.ID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail != nil {
+		if err := s.fail(ids); err != nil {
+			return err
+		}
+	}
+	s.writes = append(s.writes, ids)
+	return nil
+}
+
+func (s *fakeStore) AppendBatch(evs []models.OrderEvent) error { return s.write(evs) }
+func (s *fakeStore) Append(ev models.OrderEvent) error         { return s.write([]models.OrderEvent{ev}) }
+func (s *fakeStore) Health() error                             { return nil }
+
+func (s *fakeStore) ReplaySince(time.Time, func(models.OrderEvent) bool) error { return nil }
+
+func (s *fakeStore) written() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.writes)
+}
+
+// appendOnly hides AppendBatch, so the writer falls back to one Append
+// per event.
+type appendOnly struct{ s *fakeStore }
+
+func (a appendOnly) Append(ev models.OrderEvent) error { return a.s.Append(ev) }
+func (a appendOnly) Health() error                     { return nil }
+
+func (a appendOnly) ReplaySince(time.Time, func(models.OrderEvent) bool) error { return nil }
+
+func ev(id string) models.OrderEvent { return models.OrderEvent{ID: id, OrderID: "o-1"} }
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockFirstCommit starts an Append of "first" and returns once its commit
+// is stuck in the store; the returned channel yields its result.
+func blockFirstCommit(t *testing.T, w *Writer, s *fakeStore) <-chan error {
+	t.Helper()
+	res := make(chan error, 1)
+	go func() { res <- w.Append(ev("first")) }()
+	select {
+	case <-s.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("first commit never reached the store")
+	}
+	return res
+}
+
+func TestWriterGroupsWaitingAppends(t *testing.T) {
+	s := newFakeStore()
+	w := NewWriter(s, 0, 0)
+	defer w.Close()
+	first := blockFirstCommit(t, w, s)
+
+	const n = 20
+	errs := make(chan error, n)
+	for i := range n {
+		go func() { errs <- w.Append(ev(fmt.Sprint(i))) }()
+	}
+	eventually(t, "appends to queue", func() bool { return len(w.in) == n })
+	close(s.hold)
+
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	for range n {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Everything that queued behind the first commit shares the second.
+	got := s.written()
+	if len(got) != 2 || len(got[0]) != 1 || len(got[1]) != n {
+		t.Fatalf("writes %v, want 1 then %d events", got, n)
+	}
+}
+
+func TestWriterKeepsOrderAndMaxBatch(t *testing.T) {
+	s := newFakeStore()
+	w := NewWriter(s, 0, 4)
+	first := blockFirstCommit(t, w, s)
+
+	var want []string
+	for i := range 10 {
+		id := fmt.Sprint(i)
+		want = append(want, id)
+		if err := w.Enqueue(ev(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := make(chan error, 1)
+	go func() { last <- w.Append(ev("last")) }()
+	want = append(want, "last")
+	eventually(t, "appends to queue", func() bool { return len(w.in) == 11 })
+	close(s.hold)
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	// Append returns only once its commit, and every one queued before it,
+	// is done.
+	if err := <-last; err != nil {
+		t.Fatal(err)
+	}
+
+	got := s.written()
+	var sizes []int
+	for _, b := range got {
+		sizes = append(sizes, len(b))
+	}
+	if !slices.Equal(sizes, []int{1, 4, 4, 3}) {
+		t.Fatalf("batch sizes %v, want [1 4 4 3]", sizes)
+	}
+	if ids := slices.Concat(got[1:]...); !slices.Equal(ids, want) {
+		t.Fatalf("written %v, want %v", ids, want)
+	}
+	w.Close()
+}
+
+func TestWriterFailedBatchErrorsEveryWaiter(t *testing.T) {
+	boom := errors.New("disk full")
+	s := newFakeStore()
+	s.fail = func(ids []string) error {
+		if slices.Contains(ids, "0") {
+			return boom
+		}
+		return nil
+	}
+	w := NewWriter(s, 0, 0)
+	defer w.Close()
+	first := blockFirstCommit(t, w, s)
+
+	const n = 10
+	errs := make(chan error, n)
+	for i := range n {
+		go func() { errs <- w.Append(ev(fmt.Sprint(i))) }()
+	}
+	eventually(t, "appends to queue", func() bool { return len(w.in) == n })
+	close(s.hold)
+
+	if err := <-first; err != nil {
+		t.Fatalf("first commit: %v", err)
+	}
+	for i := range n {
+		if err := <-errs; !errors.Is(err, boom) {
+			t.Fatalf("waiter %d: err = %v, want the batch's error", i, err)
+		}
+	}
+	if err := w.Health(); !errors.Is(err, boom) {
+		t.Fatalf("health %v after a failed commit", err)
+	}
+	if err := w.Append(ev("next")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Health(); err != nil {
+		t.Fatalf("health %v after a good commit", err)
+	}
+}
+
+func TestWriterWithoutBatcherStopsAtFirstError(t *testing.T) {
+	boom := errors.New("disk full")
+	s := newFakeStore()
+	s.fail = func(ids []string) error {
+		if ids[0] == "bad" {
+			return boom
+		}
+		return nil
+	}
+	w := NewWriter(appendOnly{s}, 0, 0)
+	defer w.Close()
+	first := blockFirstCommit(t, w, s)
+
+	for _, id := range []string{"a", "bad", "b"} {
+		if err := w.Enqueue(ev(id)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	last := make(chan error, 1)
+	go func() { last <- w.Append(ev("c")) }()
+	eventually(t, "appends to queue", func() bool { return len(w.in) == 4 })
+	close(s.hold)
+
+	if err := <-first; err != nil {
+		t.Fatal(err)
+	}
+	// "c" shares the batch with "bad", so it fails although it was never
+	// written, and nothing after "bad" is.
+	if err := <-last; !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want the batch's error", err)
+	}
+	if got := slices.Concat(s.written()...); !slices.Equal(got, []string{"first", "a"}) {
+		t.Fatalf("written %v", got)
+	}
+}
+
+func TestWriterCloseFlushes(t *testing.T) {
+	s := newFakeStore()
+	close(s.hold)
+	w := NewWriter(s, 0, 0)
+	for i := range 100 {
+		if err := w.Enqueue(ev(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	if n := len(slices.Concat(s.written()...)); n != 100 {
+		t.Fatalf("%d of 100 events written by Close", n)
+	}
+	if err := w.Append(ev("late")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Append after Close: %v", err)
+	}
+	if err := w.Enqueue(ev("late")); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Enqueue after Close: %v", err)
+	}
+	w.Close()
+}
+
+func TestWriterFileStoreRoundTrip(t *testing.T) {
+	fs, err := NewFileStore(filepath.Join(t.TempDir(), "events.ndjson"), 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fs.Close()
+	w := NewWriter(fs, 0, 8)
+	since := time.Now().Add(-time.Minute)
+	var (
+		wg   sync.WaitGroup
+		want []string
+	)
+	for i := range 50 {
+		id := fmt.Sprint(i)
+		want = append(want, id)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.Append(models.OrderEvent{ID: id, OrderID: "o-1", TS: time.Now()}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	w.Close()
+
+	var got []string
+	if err := w.ReplaySince(since, func(ev models.OrderEvent) bool {
+		got = append(got, ev.ID)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(got)
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Fatalf("replayed %v", got)
+	}
+}
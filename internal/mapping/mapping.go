@@ -0,0 +1,237 @@
+package mapping
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"orderpulse-api/internal/codec"
+	"orderpulse-api/internal/models"
+)
+
+// Field describes how one OrderEvent field is extracted. In the config file
+// it may be given as a bare path string or as an object.
+type Field struct {
+	Paths     []string          `json:"paths,omitempty"`
+	Path      string            `json:"path,omitempty"`
+	Default   any               `json:"default,omitempty"`
+	Transform string            `json:"transform,omitempty"`
+	Values    map[string]string `json:"values,omitempty"`
+	Multiply  float64           `json:"multiply,omitempty"`
+}
+
+func (f *Field) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &f.Path)
+	}
+	type plain Field
+	return json.Unmarshal(b, (*plain)(f))
+}
+
+type Spec struct {
+	Root     string           `json:"root,omitempty"`
+	Fields   map[string]Field `json:"fields"`
+	Required []string         `json:"required,omitempty"`
+}
+
+type ValidationError struct {
+	Field string
+	Msg   string
+}
+
+func (e *ValidationError) Error() string { return e.Field + ": " + e.Msg }
+
+var fieldNames = []string{"id", "orderId", "type", "status", "amount", "ts", "channel"}
+
+type compiledField struct {
+	paths []Path
+	Field
+}
+
+// Mapper applies a compiled Spec to decoded documents.
+type Mapper struct {
+	root     *Path
+	fields   map[string]compiledField
+	required []string
+}
+
+func Compile(spec Spec) (*Mapper, error) {
+	m := &Mapper{fields: map[string]compiledField{}, required: spec.Required}
+	if spec.Root != "" {
+		p, err := ParsePath(spec.Root)
+		if err != nil {
+			return nil, err
+		}
+		m.root = &p
+	}
+	for name, f := range spec.Fields {
+		if !known(name) {
+			return nil, fmt.Errorf("unknown field %q", name)
+		}
+		switch f.Transform {
+		case "", "lower", "upper", "trim":
+		default:
+			return nil, fmt.Errorf("field %s: unknown transform %q", name, f.Transform)
+		}
+		cf := compiledField{Field: f}
+		raw := f.Paths
+		if f.Path != "" {
+			raw = append([]string{f.Path}, raw...)
+		}
+		for _, s := range raw {
+			p, err := ParsePath(s)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", name, err)
+			}
+			cf.paths = append(cf.paths, p)
+		}
+		if len(cf.paths) == 0 && f.Default == nil {
+			return nil, fmt.Errorf("field %s: needs a path or a default", name)
+		}
+		m.fields[name] = cf
+	}
+	for _, r := range spec.Required {
+		if !known(r) {
+			return nil, fmt.Errorf("unknown required field %q", r)
+		}
+	}
+	return m, nil
+}
+
+func known(name string) bool {
+	for _, n := range fieldNames {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Map builds an event from doc. Fields without a rule fall back to the
+// document's own OrderEvent-shaped keys.
+func (m *Mapper) Map(doc map[string]any) (models.OrderEvent, error) {
+	src := doc
+	if m.root != nil {
+		v, ok := m.root.Lookup(doc)
+		obj, isObj := v.(map[string]any)
+		if !ok || !isObj {
+			return models.OrderEvent{}, &ValidationError{Field: "root", Msg: "no object at " + m.root.String()}
+		}
+		src = obj
+	}
+	out := map[string]any{}
+	for _, n := range fieldNames {
+		if v, ok := src[n]; ok {
+			out[n] = v
+		}
+	}
+	for name, f := range m.fields {
+		v, err := f.resolve(doc, src)
+		if err != nil {
+			return models.OrderEvent{}, &ValidationError{Field: name, Msg: err.Error()}
+		}
+		if v == nil {
+			delete(out, name)
+			continue
+		}
+		out[name] = v
+	}
+	ev, err := codec.ToEvent(out)
+	if err != nil {
+		name, msg, _ := strings.Cut(err.Error(), ": ")
+		return ev, &ValidationError{Field: name, Msg: msg}
+	}
+	for _, r := range m.required {
+		if isZero(ev, r) {
+			return ev, &ValidationError{Field: r, Msg: "required"}
+		}
+	}
+	return ev, nil
+}
+
+// resolve evaluates paths against the root object first and then the whole
+// document, so "$.meta.id" keeps working when root points elsewhere.
+func (f compiledField) resolve(doc, src map[string]any) (any, error) {
+	var v any
+	for _, p := range f.paths {
+		if x, ok := p.Lookup(src); ok {
+			v = x
+			break
+		}
+		if x, ok := p.Lookup(doc); ok {
+			v = x
+			break
+		}
+	}
+	if v == nil {
+		v = f.Default
+	}
+	if v == nil {
+		return nil, nil
+	}
+	if f.Values != nil {
+		if mapped, ok := f.Values[codec.String(v)]; ok {
+			v = mapped
+		}
+	}
+	switch f.Transform {
+	case "lower":
+		v = strings.ToLower(codec.String(v))
+	case "upper":
+		v = strings.ToUpper(codec.String(v))
+	case "trim":
+		v = strings.TrimSpace(codec.String(v))
+	}
+	if f.Multiply != 0 {
+		n, err := codec.Float(v)
+		if err != nil {
+			return nil, err
+		}
+		v = math.Round(n * f.Multiply)
+	}
+	return v, nil
+}
+
+func isZero(ev models.OrderEvent, field string) bool {
+	switch field {
+	case "id":
+		return ev.ID == ""
+	case "orderId":
+		return ev.OrderID == ""
+	case "type":
+		return ev.Type == ""
+	case "status":
+		return ev.Status == ""
+	case "amount":
+		return ev.Amount == 0
+	case "ts":
+		return ev.TS.IsZero()
+	case "channel":
+		return ev.Channel == ""
+	}
+	return false
+}
+
+// Load reads a per-source mapping file of the form {"kafka": {...}, ...}.
+func Load(path string) (map[string]*Mapper, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	specs := map[string]Spec{}
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return nil, err
+	}
+	out := make(map[string]*Mapper, len(specs))
+	for src, spec := range specs {
+		m, err := Compile(spec)
+		if err != nil {
+			return nil, fmt.Errorf("mapping %s: %w", src, err)
+		}
+		out[src] = m
+	}
+	return out, nil
+}
@@ -0,0 +1,171 @@
+package mapping
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func decode(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(s), &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestPath(t *testing.T) {
+	doc := decode(t, `{"a": {"b c": [10, {"d": "x"}], "n": null}, "list": [1, 2, 3]}`)
+	tests := []struct {
+		path string
+		want any
+		ok   bool
+	}{
+		{"$", doc, true},
+		{"$.a['b c'][0]", 10.0, true},
+		{`$.a["b c"][1].d`, "x", true},
+		{"$['a']['b c'][-1].d", "x", true},
+		{"$.list[2]", 3.0, true},
+		{"$.list[3]", nil, false},
+		{"$.list[-4]", nil, false},
+		{"$.a.n", nil, false},
+		{"$.a.missing", nil, false},
+		{"$.list.x", nil, false},
+		{"$.a[0]", nil, false},
+	}
+	for _, tt := range tests {
+		p, err := ParsePath(tt.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.path, err)
+		}
+		got, ok := p.Lookup(doc)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, %v; want %v, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	for _, bad := range []string{"a.b", "$.", "$..a", "$[0", "$[x]", "$a", "$.a[]"} {
+		if _, err := ParsePath(bad); err == nil {
+			t.Errorf("%q parsed", bad)
+		}
+	}
+}
+
+const spec = `{
+	"root": "$.data",
+	"fields": {
+		"id": {"paths": ["$.uuid", "$.meta.eventId"]},
+		"orderId": "$.order.number",
+		"status": {"path": "$.state", "values": {"COMPLETE": "paid", "VOID": "cancelled"}, "transform": "lower"},
+		"type": {"default": "status_changed"},
+		"amount": {"path": "$.total", "multiply": 100},
+		"ts": "$.when"
+	},
+	"required": ["id", "orderId"]
+}`
+
+func compile(t *testing.T, s string) *Mapper {
+	t.Helper()
+	var sp Spec
+	if err := json.Unmarshal([]byte(s), &sp); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Compile(sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMap(t *testing.T) {
+	m := compile(t, spec)
+	ev, err := m.Map(decode(t, `{
+		"meta": {"eventId": "m-1"},
+		"data": {"order": {"number": "A-100"}, "state": "COMPLETE", "total": 19.99, "when": "2026-10-01T12:00:00Z", "channel": "merchant:m-1"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// id falls back to the second path, resolved against the whole document.
+	if ev.ID != "m-1" || ev.OrderID != "A-100" || ev.Status != "paid" || ev.Type != "status_changed" || ev.Amount != 1999 {
+		t.Fatalf("mapped %+v", ev)
+	}
+	if !ev.TS.Equal(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("ts %v", ev.TS)
+	}
+	// Unmapped OrderEvent-shaped keys under root pass through.
+	if ev.Channel != "merchant:m-1" {
+		t.Fatalf("channel %q", ev.Channel)
+	}
+
+	// A value without a mapping is kept, then transformed.
+	ev, err = m.Map(decode(t, `{"data": {"uuid": "u-1", "order": {"number": "A-1"}, "state": "Refunded"}}`))
+	if err != nil || ev.ID != "u-1" || ev.Status != "refunded" {
+		t.Fatalf("mapped %+v, %v", ev, err)
+	}
+}
+
+func TestMapValidation(t *testing.T) {
+	m := compile(t, spec)
+	tests := []struct {
+		doc   string
+		field string
+	}{
+		{`{"other": {}}`, "root"},
+		{`{"data": "not an object"}`, "root"},
+		{`{"data": {"uuid": "u-1"}}`, "orderId"},
+		{`{"data": {"order": {"number": "A-1"}}}`, "id"},
+		{`{"data": {"uuid": "u-1", "order": {"number": "A-1"}, "total": "lots"}}`, "amount"},
+	}
+	for _, tt := range tests {
+		_, err := m.Map(decode(t, tt.doc))
+		var ve *ValidationError
+		if !errors.As(err, &ve) || ve.Field != tt.field {
+			t.Errorf("%s: err = %v, want a %s validation error", tt.doc, err, tt.field)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, s := range []string{
+		`{"fields": {"price": "$.p"}}`,
+		`{"fields": {"status": {"path": "$.s", "transform": "title"}}}`,
+		`{"fields": {"status": {}}}`,
+		`{"fields": {"id": "id"}}`,
+		`{"root": "data", "fields": {}}`,
+		`{"fields": {}, "required": ["price"]}`,
+	} {
+		var sp Spec
+		if err := json.Unmarshal([]byte(s), &sp); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Compile(sp); err == nil {
+			t.Errorf("%s compiled", s)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.json")
+	if err := os.WriteFile(path, []byte(`{"kafka": `+spec+`, "amqp": {"fields": {"id": "$.ref"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ms, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 || ms["kafka"] == nil || ms["amqp"] == nil {
+		t.Fatalf("loaded %v", ms)
+	}
+	if err := os.WriteFile(path, []byte(`{"kafka": {"fields": {"nope": "$.x"}}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Fatal("loaded an invalid mapping")
+	}
+}
@@ -0,0 +1,93 @@
+package mapping
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type step struct {
+	key   string
+	index int
+	isIdx bool
+}
+
+// Path is a compiled JSONPath subset: $, .name, ['name'] and [n].
+type Path struct {
+	raw   string
+	steps []step
+}
+
+func ParsePath(s string) (Path, error) {
+	p := Path{raw: s}
+	rest := strings.TrimSpace(s)
+	if !strings.HasPrefix(rest, "$") {
+		return p, fmt.Errorf("path %q: must start with $", s)
+	}
+	rest = rest[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return p, fmt.Errorf("path %q: empty segment", s)
+			}
+			p.steps = append(p.steps, step{key: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return p, fmt.Errorf("path %q: unterminated [", s)
+			}
+			in := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if len(in) >= 2 && (in[0] == '\'' || in[0] == '"') && in[len(in)-1] == in[0] {
+				p.steps = append(p.steps, step{key: in[1 : len(in)-1]})
+				continue
+			}
+			n, err := strconv.Atoi(in)
+			if err != nil {
+				return p, fmt.Errorf("path %q: bad index %q", s, in)
+			}
+			p.steps = append(p.steps, step{index: n, isIdx: true})
+		default:
+			return p, fmt.Errorf("path %q: unexpected %q", s, rest[0])
+		}
+	}
+	return p, nil
+}
+
+func (p Path) String() string { return p.raw }
+
+func (p Path) Lookup(doc any) (any, bool) {
+	cur := doc
+	for _, st := range p.steps {
+		if st.isIdx {
+			arr, ok := cur.([]any)
+			if !ok {
+				return nil, false
+			}
+			i := st.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, false
+			}
+			cur = arr[i]
+			continue
+		}
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[st.key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
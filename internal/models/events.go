@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"regexp"
+	"time"
+)
 
 type OrderEvent struct {
 	ID      string    `json:"id"`
@@ -9,4 +12,18 @@ type OrderEvent struct {
 	Status  string    `json:"status"`
 	Amount  int       `json:"amount"`
 	TS      time.Time `json:"ts"`
+	Late    bool      `json:"late,omitempty"`
+	Channel string    `json:"channel,omitempty"`
+	Origin  string    `json:"origin,omitempty"` // cluster node that first published it
+
+	Attrs map[string]string `json:"attrs,omitempty"`
+
+	Wire *Wire `json:"-"` // set by the hub, see Wire
 }
+
+var channelRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._:-]{0,63}$`)
+
+// ValidChannel reports whether name can be published to: empty (the default
+// channel) or 1-64 letters, digits, '.', '_', ':' or '-', e.g. "alerts" or
+// "merchant:m-42".
+func ValidChannel(name string) bool { return name == "" || channelRe.MatchString(name) }
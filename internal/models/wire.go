@@ -0,0 +1,37 @@
+package models
+
+import "sync"
+
+// Wire caches encodings of one published event. The hub attaches a fresh
+// one on Publish and every copy handed to subscribers shares it, so each
+// distinct payload (a projection, a wire format) is built once per event
+// rather than once per connection. A nil Wire caches nothing.
+type Wire struct {
+	mu sync.Mutex
+	m  map[string]*wireEntry
+}
+
+type wireEntry struct {
+	once sync.Once
+	v    any
+}
+
+// Load returns the value cached under key, building it on first use.
+// Builds for different keys run concurrently and may themselves Load.
+func (w *Wire) Load(key string, build func() any) any {
+	if w == nil {
+		return build()
+	}
+	w.mu.Lock()
+	e := w.m[key]
+	if e == nil {
+		if w.m == nil {
+			w.m = make(map[string]*wireEntry, 2)
+		}
+		e = &wireEntry{}
+		w.m[key] = e
+	}
+	w.mu.Unlock()
+	e.once.Do(func() { e.v = build() })
+	return e.v
+}
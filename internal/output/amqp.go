@@ -0,0 +1,102 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"orderpulse-api/internal/models"
+)
+
+// AMQP publishes to an exchange with publisher confirms. The routing key may
+// reference {type}, {status} and {orderId}. The connection is dialled lazily
+// and re-dialled after a failure.
+type AMQP struct {
+	url      string
+	exchange string
+	key      string
+
+	mu   sync.Mutex
+	conn *amqp.Connection
+	ch   *amqp.Channel
+}
+
+func NewAMQP(url, exchange, routingKey string) (*AMQP, error) {
+	if url == "" {
+		return nil, errors.New("amqp output needs url")
+	}
+	return &AMQP{url: url, exchange: exchange, key: routingKey}, nil
+}
+
+func (a *AMQP) channel() (*amqp.Channel, error) {
+	if a.ch != nil && !a.ch.IsClosed() {
+		return a.ch, nil
+	}
+	a.reset()
+	conn, err := amqp.Dial(a.url)
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err == nil {
+		err = ch.Confirm(false)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	a.conn, a.ch = conn, ch
+	return ch, nil
+}
+
+func (a *AMQP) reset() {
+	if a.conn != nil {
+		_ = a.conn.Close()
+	}
+	a.conn, a.ch = nil, nil
+}
+
+func (a *AMQP) routingKey(ev models.OrderEvent) string {
+	return strings.NewReplacer("{type}", ev.Type, "{status}", ev.Status, "{orderId}", ev.OrderID).Replace(a.key)
+}
+
+func (a *AMQP) Send(ctx context.Context, batch []models.OrderEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ch, err := a.channel()
+	if err != nil {
+		return err
+	}
+	for _, ev := range batch {
+		b, _ := json.Marshal(ev)
+		conf, err := ch.PublishWithDeferredConfirmWithContext(ctx, a.exchange, a.routingKey(ev), false, false, amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    ev.ID,
+			Timestamp:    ev.TS,
+			Body:         b,
+		})
+		if err != nil {
+			a.reset()
+			return err
+		}
+		if ok, err := conf.WaitContext(ctx); err != nil || !ok {
+			a.reset()
+			if err == nil {
+				err = errors.New("amqp: publish nacked")
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *AMQP) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.reset()
+	return nil
+}
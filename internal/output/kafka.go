@@ -0,0 +1,45 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"orderpulse-api/internal/models"
+)
+
+// Kafka writes one message per event, keyed by order ID so an order's events
+// stay on one partition.
+type Kafka struct {
+	w *kafka.Writer
+}
+
+func NewKafka(brokers []string, topic string) (*Kafka, error) {
+	if len(brokers) == 0 || topic == "" {
+		return nil, errors.New("kafka output needs brokers and topic")
+	}
+	return &Kafka{w: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
+	}}, nil
+}
+
+func (k *Kafka) Send(ctx context.Context, batch []models.OrderEvent) error {
+	msgs := make([]kafka.Message, 0, len(batch))
+	for _, ev := range batch {
+		b, _ := json.Marshal(ev)
+		msgs = append(msgs, kafka.Message{
+			Key:     []byte(ev.OrderID),
+			Value:   b,
+			Headers: []kafka.Header{{Key: "content-type", Value: []byte("application/json")}},
+		})
+	}
+	return k.w.WriteMessages(ctx, msgs...)
+}
+
+func (k *Kafka) Close() error { return k.w.Close() }
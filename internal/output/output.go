@@ -0,0 +1,249 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/models"
+	"orderpulse-api/internal/pipeline"
+	"orderpulse-api/internal/stream"
+)
+
+var (
+	deliveredCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "output_delivered_total",
+		Help: "events delivered by output sinks",
+	}, []string{"sink"})
+	failedCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "output_failed_total",
+		Help: "events given up on after all retries",
+	}, []string{"sink"})
+	retriesCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "output_retries_total",
+		Help: "output delivery retries",
+	}, []string{"sink"})
+	queueGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "output_queue_depth",
+		Help: "events buffered per output sink",
+	}, []string{"sink"})
+)
+
+func init() { prometheus.MustRegister(deliveredCtr, failedCtr, retriesCtr, queueGauge) }
+
+// Sink delivers a batch of events to one destination.
+type Sink interface {
+	Send(ctx context.Context, batch []models.OrderEvent) error
+	Close() error
+}
+
+type Options struct {
+	Buffer     int
+	Batch      int
+	Linger     time.Duration
+	MaxRetries int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+func (o *Options) defaults() {
+	if o.Buffer <= 0 {
+		o.Buffer = 1024
+	}
+	if o.Batch <= 0 {
+		o.Batch = 1
+	}
+	if o.Linger <= 0 {
+		o.Linger = 100 * time.Millisecond
+	}
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = 5
+	}
+	if o.Backoff <= 0 {
+		o.Backoff = 500 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 30 * time.Second
+	}
+}
+
+// Forwarder subscribes a sink to the hub with its own buffer, filter and
+// optional processor chain.
+type Forwarder struct {
+	Name      string
+	Sink      Sink
+	Filter    stream.Filter
+	Transform pipeline.Chain
+	Opts      Options
+}
+
+func (f *Forwarder) Run(ctx context.Context, hub *stream.Hub) {
+	f.Opts.defaults()
+	defer f.Sink.Close()
+	sub := hub.Subscribe(ctx, f.Opts.Buffer, stream.Filtered(f.Filter))
+	linger := time.NewTimer(f.Opts.Linger)
+	defer linger.Stop()
+
+	batch := make([]models.OrderEvent, 0, f.Opts.Batch)
+	flush := func() {
+		if len(batch) > 0 {
+			f.deliver(ctx, batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case ev, ok := <-sub:
+			if !ok {
+				flush()
+				return
+			}
+			queueGauge.WithLabelValues(f.Name).Set(float64(len(sub)))
+			out := []models.OrderEvent{ev}
+			if len(f.Transform) > 0 {
+				var err error
+				if out, err = f.Transform.Process(ctx, "output:"+f.Name, ev); err != nil {
+					log.Warn().Err(err).Str("sink", f.Name).Msg("output transform")
+					continue
+				}
+			}
+			batch = append(batch, out...)
+			if len(batch) >= f.Opts.Batch {
+				flush()
+			}
+		case <-linger.C:
+			flush()
+			linger.Reset(f.Opts.Linger)
+		}
+	}
+}
+
+// deliver retries with exponential backoff and gives up after MaxRetries.
+func (f *Forwarder) deliver(ctx context.Context, batch []models.OrderEvent) {
+	backoff := f.Opts.Backoff
+	for attempt := 0; ; attempt++ {
+		err := f.Sink.Send(ctx, batch)
+		if err == nil {
+			deliveredCtr.WithLabelValues(f.Name).Add(float64(len(batch)))
+			return
+		}
+		var perm *PermanentError
+		if attempt >= f.Opts.MaxRetries || errors.As(err, &perm) || ctx.Err() != nil {
+			failedCtr.WithLabelValues(f.Name).Add(float64(len(batch)))
+			log.Error().Err(err).Str("sink", f.Name).Int("events", len(batch)).Msg("output failed")
+			return
+		}
+		retriesCtr.WithLabelValues(f.Name).Inc()
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, f.Opts.MaxBackoff)
+	}
+}
+
+// PermanentError marks a failure that retrying will not fix, such as a 4xx
+// from a webhook.
+type PermanentError struct{ Err error }
+
+func (e *PermanentError) Error() string { return e.Err.Error() }
+func (e *PermanentError) Unwrap() error { return e.Err }
+
+// Spec is one entry of the OUTPUTS_CONFIG file.
+type Spec struct {
+	Name      string          `json:"name"`
+	Type      string          `json:"type"`
+	Filter    stream.Filter   `json:"filter"`
+	Transform []pipeline.Spec `json:"transform"`
+
+	Buffer     int    `json:"buffer"`
+	Batch      int    `json:"batch"`
+	Linger     string `json:"linger"`
+	MaxRetries int    `json:"maxRetries"`
+	Backoff    string `json:"backoff"`
+	MaxBackoff string `json:"maxBackoff"`
+
+	// webhook
+	URL     string            `json:"url"`
+	Secret  string            `json:"secret"`
+	Headers map[string]string `json:"headers"`
+	Timeout string            `json:"timeout"`
+	// kafka
+	Brokers []string `json:"brokers"`
+	Topic   string   `json:"topic"`
+	// amqp (URL shared with webhook)
+	Exchange   string `json:"exchange"`
+	RoutingKey string `json:"routingKey"`
+}
+
+func Load(path string) ([]*Forwarder, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var specs []Spec
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return nil, err
+	}
+	out := make([]*Forwarder, 0, len(specs))
+	for i, s := range specs {
+		f, err := Build(s)
+		if err != nil {
+			return nil, fmt.Errorf("output %d (%s): %w", i, s.Name, err)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+func Build(s Spec) (*Forwarder, error) {
+	if s.Name == "" {
+		s.Name = s.Type
+	}
+	f := &Forwarder{Name: s.Name, Filter: s.Filter, Opts: Options{Buffer: s.Buffer, Batch: s.Batch, MaxRetries: s.MaxRetries}}
+	if err := f.Filter.Compile(); err != nil {
+		return nil, err
+	}
+	var err error
+	for _, d := range []struct {
+		raw string
+		dst *time.Duration
+	}{{s.Linger, &f.Opts.Linger}, {s.Backoff, &f.Opts.Backoff}, {s.MaxBackoff, &f.Opts.MaxBackoff}} {
+		if d.raw == "" {
+			continue
+		}
+		if *d.dst, err = time.ParseDuration(d.raw); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.Transform) > 0 {
+		if f.Transform, err = pipeline.Build(s.Transform); err != nil {
+			return nil, err
+		}
+	}
+	switch s.Type {
+	case "webhook":
+		timeout := 10 * time.Second
+		if s.Timeout != "" {
+			if timeout, err = time.ParseDuration(s.Timeout); err != nil {
+				return nil, err
+			}
+		}
+		f.Sink, err = NewWebhook(s.URL, s.Secret, s.Headers, timeout)
+	case "kafka":
+		f.Sink, err = NewKafka(s.Brokers, s.Topic)
+	case "amqp":
+		f.Sink, err = NewAMQP(s.URL, s.Exchange, s.RoutingKey)
+	default:
+		err = fmt.Errorf("unknown type %q", s.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
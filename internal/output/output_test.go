@@ -0,0 +1,270 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"orderpulse-api/internal/models"
+	"orderpulse-api/internal/pipeline"
+	"orderpulse-api/internal/stream"
+)
+
+// fakeSink records every batch it is sent and fails the first len(errs)
+// attempts with those errors.
+type fakeSink struct {
+	mu      sync.Mutex
+	errs    []error
+	batches [][]string
+	closed  bool
+}
+
+func (s *fakeSink) Send(_ context.Context, batch []models.OrderEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, len(batch))
+	for i, ev := range batch {
+		ids[i] = ev.ID
+	}
+	s.batches = append(s.batches, ids)
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func (s *fakeSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *fakeSink) sent() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.batches)
+}
+
+func (s *fakeSink) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = nil
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// run starts f against a fresh hub and returns once its subscription is
+// live, with the warmup events flushed and forgotten.
+func run(t *testing.T, f *Forwarder) (*stream.Hub, *fakeSink) {
+	t.Helper()
+	sink := &fakeSink{}
+	f.Sink = sink
+	hub := stream.NewHub(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f.Run(ctx, hub)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		hub.Close()
+		if !sink.closed {
+			t.Error("sink not closed when the forwarder stopped")
+		}
+	})
+	eventually(t, "subscription", func() bool {
+		_ = hub.Publish(models.OrderEvent{ID: "warmup", OrderID: "o-0", Status: "paid", Amount: 500})
+		return len(sink.sent()) > 0
+	})
+	time.Sleep(2 * f.Opts.Linger)
+	sink.reset()
+	return hub, sink
+}
+
+func publish(t *testing.T, hub *stream.Hub, evs ...models.OrderEvent) {
+	t.Helper()
+	for _, ev := range evs {
+		if err := hub.Publish(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestForwarderBatchesInOrder(t *testing.T) {
+	f := &Forwarder{Name: "test", Opts: Options{Batch: 3, Linger: 50 * time.Millisecond}}
+	hub, sink := run(t, f)
+
+	var want []string
+	for i := range 7 {
+		id := fmt.Sprintf("e%d", i)
+		want = append(want, id)
+		publish(t, hub, models.OrderEvent{ID: id, OrderID: "o-1", Status: "paid"})
+	}
+	// Six go out as full batches, the seventh when the linger timer fires.
+	var got []string
+	eventually(t, "all events", func() bool {
+		got = slices.Concat(sink.sent()...)
+		return len(got) >= len(want)
+	})
+	if !slices.Equal(got, want) {
+		t.Fatalf("delivered %v, want %v", got, want)
+	}
+	full := 0
+	for _, b := range sink.sent() {
+		if len(b) > 3 {
+			t.Fatalf("batch %v over the limit", b)
+		}
+		if len(b) == 3 {
+			full++
+		}
+	}
+	if full == 0 {
+		t.Fatalf("no full batch in %v", sink.sent())
+	}
+}
+
+func TestForwarderFiltersAndTransforms(t *testing.T) {
+	var specs []pipeline.Spec
+	if err := json.Unmarshal([]byte(`[{"type":"drop","field":"amount","lt":100},{"type":"normalize"}]`), &specs); err != nil {
+		t.Fatal(err)
+	}
+	chain, err := pipeline.Build(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &Forwarder{
+		Name:      "test",
+		Filter:    stream.Filter{OrderIDs: []string{"o-0", "o-1"}},
+		Transform: chain,
+		Opts:      Options{Linger: 20 * time.Millisecond},
+	}
+	hub, sink := run(t, f)
+	publish(t, hub,
+		models.OrderEvent{ID: "other order", OrderID: "o-2", Status: "paid", Amount: 500},
+		models.OrderEvent{ID: "small", OrderID: "o-1", Status: "paid", Amount: 5},
+		models.OrderEvent{ID: "kept", OrderID: "o-1", Status: " PAID", Amount: 500},
+	)
+	eventually(t, "delivery", func() bool { return len(sink.sent()) > 0 })
+	time.Sleep(50 * time.Millisecond)
+	if got := slices.Concat(sink.sent()...); !slices.Equal(got, []string{"kept"}) {
+		t.Fatalf("delivered %v", got)
+	}
+}
+
+func TestDeliverRetries(t *testing.T) {
+	retryable := errors.New("webhook: 503 Service Unavailable")
+	tests := []struct {
+		name     string
+		errs     []error
+		attempts int
+		failed   bool
+	}{
+		{"first try", nil, 1, false},
+		{"after retries", []error{retryable, retryable}, 3, false},
+		{"gives up after max retries", []error{retryable, retryable, retryable, retryable}, 3, true},
+		{"permanent error is not retried", []error{&PermanentError{errors.New("webhook: 400 Bad Request")}}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &fakeSink{errs: tt.errs}
+			name := "retry " + tt.name
+			f := &Forwarder{Name: name, Sink: sink, Opts: Options{MaxRetries: 2, Backoff: time.Millisecond}}
+			f.Opts.defaults()
+			counts := func() (retries, failed, delivered float64) {
+				return testutil.ToFloat64(retriesCtr.WithLabelValues(name)), testutil.ToFloat64(failedCtr.WithLabelValues(name)),
+					testutil.ToFloat64(deliveredCtr.WithLabelValues(name))
+			}
+			r0, f0, d0 := counts()
+			f.deliver(context.Background(), []models.OrderEvent{{ID: "a"}, {ID: "b"}})
+
+			sent := sink.sent()
+			if len(sent) != tt.attempts {
+				t.Fatalf("%d attempts, want %d", len(sent), tt.attempts)
+			}
+			for _, b := range sent {
+				if !slices.Equal(b, []string{"a", "b"}) {
+					t.Fatalf("retried %v", b)
+				}
+			}
+			r1, f1, d1 := counts()
+			if n := r1 - r0; n != float64(tt.attempts-1) {
+				t.Fatalf("%v retries counted", n)
+			}
+			failed, delivered := f1-f0, d1-d0
+			if tt.failed && (failed != 2 || delivered != 0) || !tt.failed && (failed != 0 || delivered != 2) {
+				t.Fatalf("failed %v, delivered %v", failed, delivered)
+			}
+		})
+	}
+}
+
+func TestDeliverStopsWithContext(t *testing.T) {
+	sink := &fakeSink{errs: []error{errors.New("down"), errors.New("down")}}
+	f := &Forwarder{Name: "cancelled", Sink: sink, Opts: Options{Backoff: time.Hour}}
+	f.Opts.defaults()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	f.deliver(ctx, []models.OrderEvent{{ID: "a"}})
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("deliver waited %v after the context ended", d)
+	}
+	if n := len(sink.sent()); n != 2 {
+		t.Fatalf("%d attempts, want 2", n)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []Spec{
+		{Type: "ftp"},
+		{Type: "webhook", URL: "ftp://example.com/hook"},
+		{Type: "webhook", URL: "https://example.com/hook", Timeout: "soon"},
+		{Type: "webhook", URL: "https://example.com/hook", Linger: "soon"},
+		{Type: "webhook", URL: "https://example.com/hook", Filter: stream.Filter{Expr: "price > 1"}},
+		{Type: "webhook", URL: "https://example.com/hook", Transform: []pipeline.Spec{{Type: "nope"}}},
+		{Type: "kafka", Brokers: []string{"localhost:9092"}},
+		{Type: "amqp", Exchange: "orders"},
+	}
+	for _, s := range tests {
+		if _, err := Build(s); err == nil {
+			t.Errorf("%+v built", s)
+		}
+	}
+	f, err := Build(Spec{Type: "webhook", URL: "https://example.com/hook", Batch: 10, Backoff: "2s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "webhook" || f.Opts.Batch != 10 || f.Opts.Backoff != 2*time.Second {
+		t.Fatalf("built %+v", f)
+	}
+}
+
+func TestAMQPRoutingKey(t *testing.T) {
+	a, err := NewAMQP("amqp://localhost", "orders", "order.{type}.{status}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k := a.routingKey(models.OrderEvent{Type: "status_changed", Status: "paid"}); k != "order.status_changed.paid" {
+		t.Fatalf("routing key %q", k)
+	}
+}
@@ -0,0 +1,158 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+// Webhook POSTs events as JSON: a single object for one-event batches,
+// otherwise an array. With a secret, requests carry X-Timestamp and
+// X-Signature: sha256=<hex HMAC of "<timestamp>.<body>">, the scheme the
+// generic inbound adapter verifies.
+type Webhook struct {
+	url     string
+	secret  string
+	headers map[string]string
+	client  *http.Client
+}
+
+func NewWebhook(rawURL, secret string, headers map[string]string, timeout time.Duration) (*Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url %q", rawURL)
+	}
+	return &Webhook{url: rawURL, secret: secret, headers: headers, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// NewPublicWebhook is NewWebhook for URLs that API clients supply: it
+// requires https, does not follow redirects and refuses to connect to
+// loopback, private, link-local and unspecified addresses. The address is
+// checked when dialling, so a hostname that resolves to one is refused too.
+func NewPublicWebhook(rawURL, secret string, headers map[string]string, timeout time.Duration) (*Webhook, error) {
+	w, err := NewWebhook(rawURL, secret, headers, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if u, _ := url.Parse(rawURL); u.Scheme != "https" {
+		return nil, fmt.Errorf("webhook url %q must use https", rawURL)
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: publicOnly}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.Proxy = nil
+	tr.DialContext = dialer.DialContext
+	w.client.Transport = tr
+	w.client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	return w, nil
+}
+
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast() || ip.IsInterfaceLocalMulticast() {
+		return fmt.Errorf("webhook: refusing to connect to non-public address %s", ip)
+	}
+	return nil
+}
+
+func Sign(secret string, ts int64, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(strconv.FormatInt(ts, 10)))
+	m.Write([]byte("."))
+	m.Write(body)
+	return "sha256=" + hex.EncodeToString(m.Sum(nil))
+}
+
+// Result describes one delivery attempt.
+type Result struct {
+	Status   int
+	Duration time.Duration
+}
+
+func (w *Webhook) Send(ctx context.Context, batch []models.OrderEvent) error {
+	_, err := w.Deliver(ctx, DeliveryID(batch), batch)
+	return err
+}
+
+// DeliveryID derives X-Delivery-Id from the event IDs in batch, so retries
+// of the same batch carry the same ID and receivers can deduplicate them.
+func DeliveryID(batch []models.OrderEvent) string {
+	if len(batch) == 1 {
+		return batch[0].ID
+	}
+	h := sha256.New()
+	for _, ev := range batch {
+		h.Write([]byte(ev.ID))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+// Deliver is Send with an explicit X-Delivery-Id that also reports the HTTP
+// status and latency. Callers pass the same id on every retry.
+func (w *Webhook) Deliver(ctx context.Context, id string, batch []models.OrderEvent) (Result, error) {
+	var body []byte
+	if len(batch) == 1 {
+		body, _ = json.Marshal(batch[0])
+	} else {
+		body, _ = json.Marshal(batch)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return Result{}, &PermanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "orderpulse-api")
+	req.Header.Set("X-Delivery-Id", id)
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	if w.secret != "" {
+		ts := time.Now().Unix()
+		req.Header.Set("X-Timestamp", strconv.FormatInt(ts, 10))
+		req.Header.Set("X-Signature", Sign(w.secret, ts, body))
+	}
+
+	start := time.Now()
+	res, err := w.client.Do(req)
+	r := Result{Duration: time.Since(start)}
+	if err != nil {
+		return r, err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	r.Status = res.StatusCode
+	switch {
+	case res.StatusCode < 300:
+		return r, nil
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusRequestTimeout || res.StatusCode >= 500:
+		return r, fmt.Errorf("webhook: %s", res.Status)
+	default:
+		return r, &PermanentError{errors.New("webhook: " + res.Status)}
+	}
+}
+
+func (w *Webhook) Close() error { return nil }
@@ -0,0 +1,154 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver answers with status and records every request.
+func receiver(t *testing.T, status int) (*httptest.Server, func() []request) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		reqs []request
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		reqs = append(reqs, request{r.Header.Clone(), b})
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]request(nil), reqs...)
+	}
+}
+
+func TestWebhookSignsAndFrames(t *testing.T) {
+	srv, reqs := receiver(t, http.StatusNoContent)
+	w, err := NewWebhook(srv.URL, "s3cret", map[string]string{"X-Tenant": "t-1"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	one := []models.OrderEvent{{ID: "e1", OrderID: "o-1"}}
+	two := []models.OrderEvent{{ID: "e1", OrderID: "o-1"}, {ID: "e2", OrderID: "o-1"}}
+	for _, batch := range [][]models.OrderEvent{one, two, two} {
+		if err := w.Send(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := reqs()
+	if len(got) != 3 {
+		t.Fatalf("%d requests", len(got))
+	}
+	for i, r := range got {
+		ts, err := strconv.ParseInt(r.header.Get("X-Timestamp"), 10, 64)
+		if err != nil || time.Since(time.Unix(ts, 0)) > time.Minute {
+			t.Fatalf("request %d: X-Timestamp %q", i, r.header.Get("X-Timestamp"))
+		}
+		if sig := r.header.Get("X-Signature"); sig != Sign("s3cret", ts, r.body) {
+			t.Fatalf("request %d: signature %q does not match the body", i, sig)
+		}
+		if r.header.Get("X-Tenant") != "t-1" || r.header.Get("Content-Type") != "application/json" {
+			t.Fatalf("request %d: headers %v", i, r.header)
+		}
+	}
+
+	// One event is sent as an object under its own id, a batch as an array
+	// under an id derived from its events, the same on every retry.
+	var ev models.OrderEvent
+	if err := json.Unmarshal(got[0].body, &ev); err != nil || ev.ID != "e1" {
+		t.Fatalf("single body %s: %v", got[0].body, err)
+	}
+	if id := got[0].header.Get("X-Delivery-Id"); id != "e1" {
+		t.Fatalf("single delivery id %q", id)
+	}
+	var evs []models.OrderEvent
+	if err := json.Unmarshal(got[1].body, &evs); err != nil || len(evs) != 2 {
+		t.Fatalf("batch body %s: %v", got[1].body, err)
+	}
+	id := got[1].header.Get("X-Delivery-Id")
+	if id == "" || id == "e1" || id != got[2].header.Get("X-Delivery-Id") {
+		t.Fatalf("batch delivery ids %q, %q", id, got[2].header.Get("X-Delivery-Id"))
+	}
+	if DeliveryID([]models.OrderEvent{{ID: "e1e"}, {ID: "2"}}) == id {
+		t.Fatal("delivery id ignores event boundaries")
+	}
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	srv, reqs := receiver(t, http.StatusOK)
+	w, _ := NewWebhook(srv.URL, "", nil, time.Second)
+	if err := w.Send(context.Background(), []models.OrderEvent{{ID: "e1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if h := reqs()[0].header; h.Get("X-Signature") != "" || h.Get("X-Timestamp") != "" {
+		t.Fatalf("unsigned webhook sent %v", h)
+	}
+}
+
+func TestWebhookStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		wantErr   bool
+		permanent bool
+	}{
+		{http.StatusOK, false, false},
+		{http.StatusAccepted, false, false},
+		{http.StatusBadRequest, true, true},
+		{http.StatusNotFound, true, true},
+		{http.StatusRequestTimeout, true, false},
+		{http.StatusTooManyRequests, true, false},
+		{http.StatusBadGateway, true, false},
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.status), func(t *testing.T) {
+			srv, _ := receiver(t, tt.status)
+			w, _ := NewWebhook(srv.URL, "", nil, time.Second)
+			res, err := w.Deliver(context.Background(), "d1", []models.OrderEvent{{ID: "e1"}})
+			if res.Status != tt.status {
+				t.Fatalf("result status %d", res.Status)
+			}
+			var perm *PermanentError
+			if (err != nil) != tt.wantErr || errors.As(err, &perm) != tt.permanent {
+				t.Fatalf("err = %v, want error %v, permanent %v", err, tt.wantErr, tt.permanent)
+			}
+		})
+	}
+}
+
+func TestPublicWebhook(t *testing.T) {
+	if _, err := NewPublicWebhook("http://example.com/hook", "", nil, time.Second); err == nil {
+		t.Fatal("accepted a plain http url")
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	w, err := NewPublicWebhook(srv.URL, "", nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Send(context.Background(), []models.OrderEvent{{ID: "e1"}})
+	if err == nil || !strings.Contains(err.Error(), "non-public address") {
+		t.Fatalf("err = %v, want the loopback address refused", err)
+	}
+}
@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+// Fields are addressed by their JSON names; "attrs.<key>" reaches Attrs.
+
+func Get(ev models.OrderEvent, field string) (string, bool) {
+	switch field {
+	case "id":
+		return ev.ID, true
+	case "orderId":
+		return ev.OrderID, true
+	case "type":
+		return ev.Type, true
+	case "status":
+		return ev.Status, true
+	case "channel":
+		return ev.Channel, true
+	case "amount":
+		return strconv.Itoa(ev.Amount), true
+	case "ts":
+		if ev.TS.IsZero() {
+			return "", true
+		}
+		return ev.TS.Format(time.RFC3339Nano), true
+	}
+	if k, ok := strings.CutPrefix(field, "attrs."); ok {
+		return ev.Attrs[k], true
+	}
+	return "", false
+}
+
+func Set(ev *models.OrderEvent, field, v string) error {
+	switch field {
+	case "id":
+		ev.ID = v
+	case "orderId":
+		ev.OrderID = v
+	case "type":
+		ev.Type = v
+	case "status":
+		ev.Status = v
+	case "channel":
+		ev.Channel = v
+	case "amount":
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("amount: %w", err)
+		}
+		ev.Amount = n
+	case "ts":
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return fmt.Errorf("ts: %w", err)
+		}
+		ev.TS = t
+	default:
+		k, ok := strings.CutPrefix(field, "attrs.")
+		if !ok {
+			return fmt.Errorf("unknown field %q", field)
+		}
+		attrs := make(map[string]string, len(ev.Attrs)+1)
+		for ak, av := range ev.Attrs {
+			attrs[ak] = av
+		}
+		attrs[k] = v
+		ev.Attrs = attrs
+	}
+	return nil
+}
+
+func checkField(field string) error {
+	if _, ok := Get(models.OrderEvent{}, field); !ok {
+		return fmt.Errorf("unknown field %q", field)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/deadletter"
+	"orderpulse-api/internal/input"
+	"orderpulse-api/internal/models"
+)
+
+var outcomeCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "pipeline_events_total",
+	Help: "events dropped or rejected by ingest processors",
+}, []string{"source", "processor", "outcome"})
+
+func init() { prometheus.MustRegister(outcomeCtr) }
+
+// Processor transforms one event into zero (drop), one or several events.
+// An error rejects the event and routes it to the dead-letter log.
+type Processor interface {
+	Name() string
+	Process(ctx context.Context, ev models.OrderEvent) ([]models.OrderEvent, error)
+}
+
+type Chain []Processor
+
+type RejectError struct {
+	Processor string
+	Err       error
+}
+
+func (e *RejectError) Error() string { return e.Processor + ": " + e.Err.Error() }
+func (e *RejectError) Unwrap() error { return e.Err }
+
+func (c Chain) Process(ctx context.Context, source string, ev models.OrderEvent) ([]models.OrderEvent, error) {
+	batch := []models.OrderEvent{ev}
+	for _, p := range c {
+		var next []models.OrderEvent
+		for _, e := range batch {
+			out, err := p.Process(ctx, e)
+			if err != nil {
+				outcomeCtr.WithLabelValues(source, p.Name(), "rejected").Inc()
+				return nil, &RejectError{Processor: p.Name(), Err: err}
+			}
+			if len(out) == 0 {
+				outcomeCtr.WithLabelValues(source, p.Name(), "dropped").Inc()
+			}
+			next = append(next, out...)
+		}
+		if batch = next; len(batch) == 0 {
+			return nil, nil
+		}
+	}
+	return batch, nil
+}
+
+// Config maps a source name to its processor list; "*" applies to sources
+// without an entry of their own.
+type Config map[string][]Spec
+
+type Spec struct {
+	Type string          `json:"type"`
+	Raw  json.RawMessage `json:"-"`
+}
+
+func (s *Spec) UnmarshalJSON(b []byte) error {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &head); err != nil {
+		return err
+	}
+	s.Type, s.Raw = head.Type, append(json.RawMessage(nil), b...)
+	return nil
+}
+
+// Factory builds a processor from its JSON spec.
+type Factory func(raw json.RawMessage) (Processor, error)
+
+var factories = map[string]Factory{}
+
+func Register(typ string, f Factory) { factories[typ] = f }
+
+func Build(specs []Spec) (Chain, error) {
+	chain := make(Chain, 0, len(specs))
+	for i, s := range specs {
+		f, ok := factories[s.Type]
+		if !ok {
+			return nil, fmt.Errorf("processor %d: unknown type %q", i, s.Type)
+		}
+		p, err := f(s.Raw)
+		if err != nil {
+			return nil, fmt.Errorf("processor %d (%s): %w", i, s.Type, err)
+		}
+		chain = append(chain, p)
+	}
+	return chain, nil
+}
+
+func Load(path string) (map[string]Chain, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return nil, err
+	}
+	out := make(map[string]Chain, len(cfg))
+	for src, specs := range cfg {
+		c, err := Build(specs)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %s: %w", src, err)
+		}
+		out[src] = c
+	}
+	return out, nil
+}
+
+// Middleware runs each source's chain before publishing. Rejected events go
+// to dlq and are not reported back to the source, so brokers still ack them.
+func Middleware(chains map[string]Chain, dlq *deadletter.Writer) input.Middleware {
+	return func(source string, next input.Publisher) input.Publisher {
+		c, ok := chains[source]
+		if !ok {
+			c = chains["*"]
+		}
+		if len(c) == 0 {
+			return next
+		}
+		return publisher{source: source, chain: c, dlq: dlq, next: next}
+	}
+}
+
+type publisher struct {
+	source string
+	chain  Chain
+	dlq    *deadletter.Writer
+	next   input.Publisher
+}
+
+func (p publisher) Publish(ev models.OrderEvent) error {
+	out, err := p.chain.Process(context.Background(), p.source, ev)
+	if err != nil {
+		b, _ := json.Marshal(ev)
+		if werr := p.dlq.Write(p.source, "pipeline", err, "application/json", b); werr != nil {
+			log.Error().Err(werr).Str("source", p.source).Msg("deadletter")
+		}
+		return nil
+	}
+	for _, e := range out {
+		if err := p.next.Publish(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"orderpulse-api/internal/deadletter"
+	"orderpulse-api/internal/models"
+)
+
+func build(t *testing.T, specs string) Chain {
+	t.Helper()
+	var s []Spec
+	if err := json.Unmarshal([]byte(specs), &s); err != nil {
+		t.Fatal(err)
+	}
+	c, err := Build(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+var order = models.OrderEvent{ID: "e1", OrderID: "m-1-100", Type: "status_changed", Status: "paid", Amount: 1999}
+
+func modified(ev models.OrderEvent, f func(*models.OrderEvent)) models.OrderEvent {
+	f(&ev)
+	return ev
+}
+
+func TestProcessors(t *testing.T) {
+	tests := []struct {
+		name    string
+		specs   string
+		in      models.OrderEvent
+		want    []models.OrderEvent // nil when dropped
+		wantErr string
+	}{
+		{"validate passes", `[{"type":"validate"}]`, order, []models.OrderEvent{order}, ""},
+		{"validate required", `[{"type":"validate"}]`, modified(order, func(e *models.OrderEvent) { e.Status = "" }), nil, "status: required"},
+		{"validate custom required", `[{"type":"validate","required":["attrs.region"]}]`, order, nil, "attrs.region: required"},
+		{"validate minAmount", `[{"type":"validate","minAmount":2000}]`, order, nil, "amount: below 2000"},
+		{"normalize defaults", `[{"type":"normalize"}]`,
+			modified(order, func(e *models.OrderEvent) { e.Status = " PAID " }), []models.OrderEvent{order}, ""},
+		{"normalize aliases after case", `[{"type":"normalize","aliases":{"complete":"paid"}}]`,
+			modified(order, func(e *models.OrderEvent) { e.Status = "Complete" }), []models.OrderEvent{order}, ""},
+		{"normalize attrs upper without trim", `[{"type":"normalize","field":"attrs.region","trim":false,"case":"upper"}]`,
+			modified(order, func(e *models.OrderEvent) { e.Attrs = map[string]string{"region": " eu"} }),
+			[]models.OrderEvent{modified(order, func(e *models.OrderEvent) { e.Attrs = map[string]string{"region": " EU"} })}, ""},
+		{"default fills empty fields only", `[{"type":"default","fields":{"type":"order.created","status":"pending","amount":"100"}}]`,
+			modified(order, func(e *models.OrderEvent) { e.Type, e.Amount = "", 0 }),
+			[]models.OrderEvent{modified(order, func(e *models.OrderEvent) { e.Type, e.Amount = "order.created", 100 })}, ""},
+		{"default bad amount", `[{"type":"default","fields":{"amount":"lots"}}]`,
+			modified(order, func(e *models.OrderEvent) { e.Amount = 0 }), nil, "amount: "},
+		{"drop in", `[{"type":"drop","field":"status","in":["test","paid"]}]`, order, nil, ""},
+		{"drop in no match", `[{"type":"drop","field":"status","in":["test"]}]`, order, []models.OrderEvent{order}, ""},
+		{"drop all conditions", `[{"type":"drop","field":"amount","lt":2000,"gte":1000}]`, order, nil, ""},
+		{"drop non-numeric never matches lt", `[{"type":"drop","field":"status","lt":1}]`, order, []models.OrderEvent{order}, ""},
+		{"keep prefix", `[{"type":"keep","field":"orderId","prefix":"m-1-"}]`, order, []models.OrderEvent{order}, ""},
+		{"keep gte", `[{"type":"keep","field":"amount","gte":2000}]`, order, nil, ""},
+		{"chain stops at first reject", `[{"type":"normalize"},{"type":"validate","minAmount":5000},{"type":"drop","field":"status","in":["paid"]}]`,
+			order, nil, "amount: below 5000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := build(t, tt.specs).Process(context.Background(), "test", tt.in)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				var re *RejectError
+				if !errors.As(err, &re) || re.Processor == "" {
+					t.Fatalf("err = %#v, want a RejectError naming the processor", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultGenerates(t *testing.T) {
+	c := build(t, `[{"type":"default","fields":{"id":"$uuid","ts":"$now"}}]`)
+	out, err := c.Process(context.Background(), "test", models.OrderEvent{OrderID: "o-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := uuid.Parse(out[0].ID); err != nil {
+		t.Fatalf("id %q: %v", out[0].ID, err)
+	}
+	if d := time.Since(out[0].TS); d < 0 || d > time.Minute {
+		t.Fatalf("ts %v", out[0].TS)
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "merchants.csv")
+	jsonPath := filepath.Join(dir, "merchants.json")
+	if err := os.WriteFile(csvPath, []byte("prefix,merchant,tier\nm-1,Acme,gold\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(jsonPath, []byte(`{"m-1-100": {"merchant": "Acme"}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		spec    string
+		in      models.OrderEvent
+		attrs   map[string]string
+		wantErr bool
+	}{
+		{"csv by prefix", `{"type":"enrich","file":"` + csvPath + `","prefix":3}`, order, map[string]string{"merchant": "Acme", "tier": "gold"}, false},
+		{"json by key", `{"type":"enrich","file":"` + jsonPath + `"}`, order, map[string]string{"merchant": "Acme"}, false},
+		{"keeps existing attrs", `{"type":"enrich","file":"` + jsonPath + `"}`,
+			modified(order, func(e *models.OrderEvent) { e.Attrs = map[string]string{"region": "eu"} }), map[string]string{"merchant": "Acme", "region": "eu"}, false},
+		{"miss passes through", `{"type":"enrich","file":"` + csvPath + `"}`, order, nil, false},
+		{"miss rejects when required", `{"type":"enrich","file":"` + csvPath + `","required":true}`, order, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := build(t, "["+tt.spec+"]").Process(context.Background(), "test", tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(out[0].Attrs, tt.attrs) {
+				t.Fatalf("attrs %v, want %v", out[0].Attrs, tt.attrs)
+			}
+		})
+	}
+	if tt := tests[2]; len(tt.in.Attrs) != 1 {
+		t.Fatalf("enrich modified the input's attrs: %v", tt.in.Attrs)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	for _, specs := range []string{
+		`[{"type":"nope"}]`,
+		`[{"type":"validate","required":["price"]}]`,
+		`[{"type":"validate","minAmmount":1}]`,
+		`[{"type":"normalize","case":"title"}]`,
+		`[{"type":"default","fields":{"price":"1"}}]`,
+		`[{"type":"drop","field":"status"}]`,
+		`[{"type":"keep","field":"price","in":["x"]}]`,
+		`[{"type":"enrich","file":"does-not-exist.csv"}]`,
+	} {
+		var s []Spec
+		if err := json.Unmarshal([]byte(specs), &s); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Build(s); err == nil {
+			t.Errorf("%s built", specs)
+		}
+	}
+}
+
+// split fans an event out into n copies with distinct ids.
+type split int
+
+func (split) Name() string { return "split" }
+
+func (n split) Process(_ context.Context, ev models.OrderEvent) ([]models.OrderEvent, error) {
+	out := make([]models.OrderEvent, n)
+	for i := range out {
+		out[i] = ev
+		out[i].ID = ev.ID + "-" + string(rune('a'+i))
+	}
+	return out, nil
+}
+
+func TestChainFansOut(t *testing.T) {
+	c := append(Chain{split(3)}, build(t, `[{"type":"drop","field":"id","in":["e1-b"]}]`)...)
+	out, err := c.Process(context.Background(), "test", order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ev := range out {
+		got = append(got, ev.ID)
+	}
+	if !reflect.DeepEqual(got, []string{"e1-a", "e1-c"}) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+type recorder struct {
+	events []models.OrderEvent
+	err    error
+}
+
+func (r *recorder) Publish(ev models.OrderEvent) error {
+	r.events = append(r.events, ev)
+	return r.err
+}
+
+func TestMiddleware(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dlq.ndjson")
+	dlq, err := deadletter.New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains := map[string]Chain{
+		"*":    build(t, `[{"type":"validate","minAmount":1}]`),
+		"mock": nil,
+	}
+	mw := Middleware(chains, dlq)
+	next := &recorder{}
+	if pub := mw("mock", next); pub != next {
+		t.Fatal("source with an empty chain was wrapped")
+	}
+
+	pub := mw("kafka", next)
+	if err := pub.Publish(order); err != nil {
+		t.Fatal(err)
+	}
+	// A rejected event is dead-lettered and reported as handled.
+	if err := pub.Publish(modified(order, func(e *models.OrderEvent) { e.ID, e.Amount = "e2", 0 })); err != nil {
+		t.Fatalf("reject returned %v", err)
+	}
+	if len(next.events) != 1 || next.events[0].ID != "e1" {
+		t.Fatalf("published %+v", next.events)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	var recs []deadletter.Record
+	for sc.Scan() {
+		var r deadletter.Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, r)
+	}
+	if len(recs) != 1 || recs[0].Source != "kafka" || recs[0].Stage != "pipeline" ||
+		!strings.Contains(recs[0].Error, "validate: amount") || !strings.Contains(recs[0].Payload, `"e2"`) {
+		t.Fatalf("dead letters %+v", recs)
+	}
+
+	// Failures after the chain still reach the source.
+	boom := errors.New("log unavailable")
+	if err := mw("kafka", &recorder{err: boom}).Publish(order); !errors.Is(err, boom) {
+		t.Fatalf("err = %v", err)
+	}
+}
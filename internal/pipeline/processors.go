@@ -0,0 +1,304 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"orderpulse-api/internal/models"
+)
+
+func init() {
+	Register("validate", newValidate)
+	Register("normalize", newNormalize)
+	Register("default", newDefault)
+	Register("enrich", newEnrich)
+	Register("drop", newCondition("drop", true))
+	Register("keep", newCondition("keep", false))
+}
+
+func decode(raw json.RawMessage, v any) error {
+	dec := json.NewDecoder(strings.NewReader(string(raw)))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+func one(ev models.OrderEvent) []models.OrderEvent { return []models.OrderEvent{ev} }
+
+// validate: {"type":"validate","required":["orderId","status"],"minAmount":0}
+type validate struct {
+	Type      string   `json:"type"`
+	Required  []string `json:"required"`
+	MinAmount *int     `json:"minAmount"`
+}
+
+func newValidate(raw json.RawMessage) (Processor, error) {
+	p := &validate{Required: []string{"orderId", "type", "status"}}
+	if err := decode(raw, p); err != nil {
+		return nil, err
+	}
+	for _, f := range p.Required {
+		if err := checkField(f); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *validate) Name() string { return "validate" }
+
+func (p *validate) Process(_ context.Context, ev models.OrderEvent) ([]models.OrderEvent, error) {
+	for _, f := range p.Required {
+		if v, _ := Get(ev, f); v == "" {
+			return nil, fmt.Errorf("%s: required", f)
+		}
+	}
+	if p.MinAmount != nil && ev.Amount < *p.MinAmount {
+		return nil, fmt.Errorf("amount: below %d", *p.MinAmount)
+	}
+	return one(ev), nil
+}
+
+// normalize: {"type":"normalize","field":"status","trim":true,"case":"lower","aliases":{"complete":"paid"}}
+type normalize struct {
+	Type    string            `json:"type"`
+	Field   string            `json:"field"`
+	Trim    bool              `json:"trim"`
+	Case    string            `json:"case"`
+	Aliases map[string]string `json:"aliases"`
+}
+
+func newNormalize(raw json.RawMessage) (Processor, error) {
+	p := &normalize{Field: "status", Trim: true, Case: "lower"}
+	if err := decode(raw, p); err != nil {
+		return nil, err
+	}
+	if err := checkField(p.Field); err != nil {
+		return nil, err
+	}
+	switch p.Case {
+	case "", "lower", "upper":
+	default:
+		return nil, fmt.Errorf("unknown case %q", p.Case)
+	}
+	return p, nil
+}
+
+func (p *normalize) Name() string { return "normalize" }
+
+func (p *normalize) Process(_ context.Context, ev models.OrderEvent) ([]models.OrderEvent, error) {
+	v, _ := Get(ev, p.Field)
+	if p.Trim {
+		v = strings.TrimSpace(v)
+	}
+	switch p.Case {
+	case "lower":
+		v = strings.ToLower(v)
+	case "upper":
+		v = strings.ToUpper(v)
+	}
+	if a, ok := p.Aliases[v]; ok {
+		v = a
+	}
+	if err := Set(&ev, p.Field, v); err != nil {
+		return nil, err
+	}
+	return one(ev), nil
+}
+
+// default: {"type":"default","fields":{"type":"status_changed","id":"$uuid","ts":"$now"}}
+type defaults struct {
+	Type   string            `json:"type"`
+	Fields map[string]string `json:"fields"`
+}
+
+func newDefault(raw json.RawMessage) (Processor, error) {
+	p := &defaults{}
+	if err := decode(raw, p); err != nil {
+		return nil, err
+	}
+	for f := range p.Fields {
+		if err := checkField(f); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *defaults) Name() string { return "default" }
+
+func (p *defaults) Process(_ context.Context, ev models.OrderEvent) ([]models.OrderEvent, error) {
+	for f, d := range p.Fields {
+		if cur, _ := Get(ev, f); cur != "" && !(f == "amount" && cur == "0") {
+			continue
+		}
+		switch d {
+		case "$uuid":
+			d = uuid.NewString()
+		case "$now":
+			d = time.Now().UTC().Format(time.RFC3339Nano)
+		}
+		if err := Set(&ev, f, d); err != nil {
+			return nil, err
+		}
+	}
+	return one(ev), nil
+}
+
+// enrich: {"type":"enrich","file":"merchants.csv","key":"orderId","prefix":3,"required":false}
+// copies the matching row into Attrs. CSV files use the first column as key
+// and the header row as attribute names; JSON files map key to an object.
+type enrich struct {
+	Type     string `json:"type"`
+	File     string `json:"file"`
+	Key      string `json:"key"`
+	Prefix   int    `json:"prefix"`
+	Required bool   `json:"required"`
+
+	table map[string]map[string]string
+}
+
+func newEnrich(raw json.RawMessage) (Processor, error) {
+	p := &enrich{Key: "orderId"}
+	if err := decode(raw, p); err != nil {
+		return nil, err
+	}
+	if err := checkField(p.Key); err != nil {
+		return nil, err
+	}
+	t, err := loadTable(p.File)
+	if err != nil {
+		return nil, err
+	}
+	p.table = t
+	return p, nil
+}
+
+func loadTable(path string) (map[string]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	out := map[string]map[string]string{}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err := json.NewDecoder(f).Decode(&out)
+		return out, err
+	}
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return out, nil
+	}
+	head := rows[0]
+	for _, row := range rows[1:] {
+		attrs := make(map[string]string, len(head)-1)
+		for i := 1; i < len(head) && i < len(row); i++ {
+			attrs[head[i]] = row[i]
+		}
+		out[row[0]] = attrs
+	}
+	return out, nil
+}
+
+func (p *enrich) Name() string { return "enrich" }
+
+func (p *enrich) Process(_ context.Context, ev models.OrderEvent) ([]models.OrderEvent, error) {
+	k, _ := Get(ev, p.Key)
+	if p.Prefix > 0 && len(k) > p.Prefix {
+		k = k[:p.Prefix]
+	}
+	row, ok := p.table[k]
+	if !ok {
+		if p.Required {
+			return nil, fmt.Errorf("no lookup entry for %s=%q", p.Key, k)
+		}
+		return one(ev), nil
+	}
+	for a, v := range row {
+		_ = Set(&ev, "attrs."+a, v)
+	}
+	return one(ev), nil
+}
+
+// drop / keep: {"type":"drop","field":"status","in":["test"]} or
+// {"type":"keep","field":"amount","gte":1}. drop removes matching events,
+// keep removes the rest.
+type condition struct {
+	Type   string   `json:"type"`
+	Field  string   `json:"field"`
+	In     []string `json:"in"`
+	Prefix string   `json:"prefix"`
+	Lt     *float64 `json:"lt"`
+	Gte    *float64 `json:"gte"`
+
+	name string
+	drop bool
+}
+
+func newCondition(name string, drop bool) Factory {
+	return func(raw json.RawMessage) (Processor, error) {
+		p := &condition{name: name, drop: drop}
+		if err := decode(raw, p); err != nil {
+			return nil, err
+		}
+		if err := checkField(p.Field); err != nil {
+			return nil, err
+		}
+		if p.In == nil && p.Prefix == "" && p.Lt == nil && p.Gte == nil {
+			return nil, errors.New("needs one of in, prefix, lt, gte")
+		}
+		return p, nil
+	}
+}
+
+func (p *condition) Name() string { return p.name }
+
+func (p *condition) match(ev models.OrderEvent) bool {
+	v, _ := Get(ev, p.Field)
+	if p.In != nil {
+		found := false
+		for _, x := range p.In {
+			if x == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if p.Prefix != "" && !strings.HasPrefix(v, p.Prefix) {
+		return false
+	}
+	if p.Lt != nil || p.Gte != nil {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return false
+		}
+		if p.Lt != nil && !(n < *p.Lt) {
+			return false
+		}
+		if p.Gte != nil && !(n >= *p.Gte) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *condition) Process(_ context.Context, ev models.OrderEvent) ([]models.OrderEvent, error) {
+	if p.match(ev) == p.drop {
+		return nil, nil
+	}
+	return one(ev), nil
+}
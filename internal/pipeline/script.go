@@ -0,0 +1,313 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/codec"
+	"orderpulse-api/internal/models"
+)
+
+var (
+	scriptRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "script_runs_total",
+		Help: "script evaluations by outcome",
+	}, []string{"script", "outcome"})
+	scriptDur = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "script_duration_seconds",
+		Help:    "script evaluation latency",
+		Buckets: []float64{.0001, .0005, .001, .005, .01, .05, .1},
+	}, []string{"script"})
+	scriptReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "script_reloads_total",
+		Help: "script reloads by result",
+	}, []string{"script", "result"})
+)
+
+func init() {
+	prometheus.MustRegister(scriptRuns, scriptDur, scriptReloads)
+	Register("script", newScript)
+}
+
+var errTimeout = errors.New("script timed out")
+
+// script runs an Expr (expr-lang) expression per event. The event's fields
+// are variables (id, orderId, type, status, amount, ts, channel, attrs) and
+// "event" is the whole event as a map. The result decides what happens:
+//
+//	nil or false   drop
+//	true           keep unchanged
+//	map            replace the event (with(event, {...}) merges changes)
+//	list of maps   fan out into several events
+//
+// {"type":"script","file":"scripts/large.expr","timeout":"20ms","memoryBudget":100000,"reload":"2s"}
+type script struct {
+	Type         string `json:"type"`
+	Label        string `json:"name"`
+	File         string `json:"file"`
+	Source       string `json:"source"`
+	Timeout      string `json:"timeout"`
+	MemoryBudget uint   `json:"memoryBudget"`
+	MaxNodes     uint   `json:"maxNodes"`
+	Reload       string `json:"reload"`
+
+	timeout time.Duration
+	reload  time.Duration
+
+	mu        sync.RWMutex
+	prog      *vm.Program
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func newScript(raw json.RawMessage) (Processor, error) {
+	p := &script{}
+	if err := decode(raw, p); err != nil {
+		return nil, err
+	}
+	if (p.File == "") == (p.Source == "") {
+		return nil, errors.New("needs exactly one of file or source")
+	}
+	if p.Label == "" {
+		p.Label = strings.TrimSuffix(filepath.Base(p.File), filepath.Ext(p.File))
+		if p.Label == "" || p.Label == "." {
+			p.Label = "inline"
+		}
+	}
+	var err error
+	if p.timeout, err = durationOr(p.Timeout, 50*time.Millisecond); err != nil {
+		return nil, fmt.Errorf("timeout: %w", err)
+	}
+	if p.reload, err = durationOr(p.Reload, 2*time.Second); err != nil {
+		return nil, fmt.Errorf("reload: %w", err)
+	}
+	if p.MaxNodes == 0 {
+		p.MaxNodes = 1000
+	}
+	if p.Source != "" {
+		p.prog, err = p.compile(p.Source)
+		return p, err
+	}
+	return p, p.load()
+}
+
+func durationOr(s string, d time.Duration) (time.Duration, error) {
+	if s == "" {
+		return d, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func (p *script) Name() string { return "script:" + p.Label }
+
+func (p *script) compile(src string) (*vm.Program, error) {
+	return expr.Compile(src,
+		expr.Env(scriptEnv(models.OrderEvent{})),
+		expr.MaxNodes(p.MaxNodes),
+		expr.Function("with", with, new(func(map[string]any, map[string]any) map[string]any)),
+	)
+}
+
+func (p *script) load() error {
+	fi, err := os.Stat(p.File)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(p.File)
+	if err != nil {
+		return err
+	}
+	prog, err := p.compile(string(b))
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.prog, p.modTime = prog, fi.ModTime()
+	p.mu.Unlock()
+	return nil
+}
+
+// maybeReload recompiles the file when its mtime changed; a broken edit
+// keeps the previous program running.
+func (p *script) maybeReload() {
+	if p.File == "" {
+		return
+	}
+	p.mu.Lock()
+	if time.Since(p.checkedAt) < p.reload {
+		p.mu.Unlock()
+		return
+	}
+	p.checkedAt = time.Now()
+	mod := p.modTime
+	p.mu.Unlock()
+
+	fi, err := os.Stat(p.File)
+	if err != nil || fi.ModTime().Equal(mod) {
+		return
+	}
+	if err := p.load(); err != nil {
+		scriptReloads.WithLabelValues(p.Label, "error").Inc()
+		log.Error().Err(err).Str("script", p.File).Msg("script reload")
+		p.mu.Lock()
+		p.modTime = fi.ModTime()
+		p.mu.Unlock()
+		return
+	}
+	scriptReloads.WithLabelValues(p.Label, "ok").Inc()
+	log.Info().Str("script", p.File).Msg("script reloaded")
+}
+
+func (p *script) Process(ctx context.Context, ev models.OrderEvent) ([]models.OrderEvent, error) {
+	p.maybeReload()
+	p.mu.RLock()
+	prog := p.prog
+	p.mu.RUnlock()
+
+	type result struct {
+		out any
+		err error
+	}
+	done := make(chan result, 1)
+	start := time.Now()
+	// The VM cannot be interrupted; on timeout the goroutine finishes on its
+	// own, bounded by MaxNodes and the memory budget.
+	go func() {
+		m := vm.VM{MemoryBudget: p.MemoryBudget}
+		out, err := m.Run(prog, scriptEnv(ev))
+		done <- result{out, err}
+	}()
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	var res result
+	select {
+	case res = <-done:
+	case <-timer.C:
+		res.err = errTimeout
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+	scriptDur.WithLabelValues(p.Label).Observe(time.Since(start).Seconds())
+	if res.err != nil {
+		outcome := "error"
+		if errors.Is(res.err, errTimeout) {
+			outcome = "timeout"
+		}
+		scriptRuns.WithLabelValues(p.Label, outcome).Inc()
+		return nil, res.err
+	}
+
+	out, err := scriptResult(ev, res.out)
+	if err != nil {
+		scriptRuns.WithLabelValues(p.Label, "error").Inc()
+		return nil, err
+	}
+	scriptRuns.WithLabelValues(p.Label, "ok").Inc()
+	return out, nil
+}
+
+func scriptEnv(ev models.OrderEvent) map[string]any {
+	m := eventMap(ev)
+	env := make(map[string]any, len(m)+1)
+	for k, v := range m {
+		env[k] = v
+	}
+	env["event"] = m
+	return env
+}
+
+func eventMap(ev models.OrderEvent) map[string]any {
+	attrs := make(map[string]any, len(ev.Attrs))
+	for k, v := range ev.Attrs {
+		attrs[k] = v
+	}
+	return map[string]any{
+		"id": ev.ID, "orderId": ev.OrderID, "type": ev.Type, "status": ev.Status,
+		"amount": ev.Amount, "ts": ev.TS, "channel": ev.Channel, "attrs": attrs,
+	}
+}
+
+func with(params ...any) (any, error) {
+	base, _ := params[0].(map[string]any)
+	patch, _ := params[1].(map[string]any)
+	out := make(map[string]any, len(base)+len(patch))
+	for k, v := range base {
+		out[k] = v
+	}
+	for k, v := range patch {
+		out[k] = v
+	}
+	return out, nil
+}
+
+func scriptResult(ev models.OrderEvent, v any) ([]models.OrderEvent, error) {
+	switch x := v.(type) {
+	case nil:
+		return nil, nil
+	case bool:
+		if x {
+			return one(ev), nil
+		}
+		return nil, nil
+	case map[string]any:
+		e, err := fromMap(ev, x)
+		if err != nil {
+			return nil, err
+		}
+		return one(e), nil
+	case []any:
+		// Copies made with with(event, ...) keep the source id, and dedup
+		// (which runs after the pipeline) would drop all but the first; a
+		// repeated id becomes "<id>#<index>".
+		out := make([]models.OrderEvent, 0, len(x))
+		seen := make(map[string]bool, len(x))
+		for i, item := range x {
+			m, ok := item.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("result[%d]: want map, got %T", i, item)
+			}
+			e, err := fromMap(ev, m)
+			if err != nil {
+				return nil, fmt.Errorf("result[%d]: %w", i, err)
+			}
+			if seen[e.ID] {
+				e.ID = fmt.Sprintf("%s#%d", e.ID, i)
+			}
+			seen[e.ID] = true
+			out = append(out, e)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("unsupported script result %T", v)
+	}
+}
+
+func fromMap(orig models.OrderEvent, m map[string]any) (models.OrderEvent, error) {
+	ev, err := codec.ToEvent(m)
+	if err != nil {
+		return ev, err
+	}
+	if ev.TS.IsZero() {
+		ev.TS = orig.TS
+	}
+	ev.Late = orig.Late
+	if attrs, ok := m["attrs"].(map[string]any); ok && len(attrs) > 0 {
+		ev.Attrs = make(map[string]string, len(attrs))
+		for k, v := range attrs {
+			ev.Attrs[k] = codec.String(v)
+		}
+	}
+	return ev, nil
+}
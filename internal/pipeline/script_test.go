@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"orderpulse-api/internal/models"
+)
+
+func newScriptProc(t *testing.T, spec map[string]any) Processor {
+	t.Helper()
+	spec["type"] = "script"
+	b, _ := json.Marshal(spec)
+	p, err := newScript(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestScriptResults(t *testing.T) {
+	tests := []struct {
+		src     string
+		want    []models.OrderEvent // nil when dropped
+		wantErr string
+	}{
+		{`status == "paid"`, []models.OrderEvent{order}, ""},
+		{`amount > 5000`, nil, ""},
+		{`nil`, nil, ""},
+		{`with(event, {status: "settled"})`, []models.OrderEvent{modified(order, func(e *models.OrderEvent) { e.Status = "settled" })}, ""},
+		{`with(event, {attrs: {region: "eu"}})`, []models.OrderEvent{modified(order, func(e *models.OrderEvent) { e.Attrs = map[string]string{"region": "eu"} })}, ""},
+		{`[with(event, {channel: "a"}), with(event, {channel: "b"}), with(event, {channel: "c"})]`, []models.OrderEvent{
+			modified(order, func(e *models.OrderEvent) { e.Channel = "a" }),
+			modified(order, func(e *models.OrderEvent) { e.ID, e.Channel = "e1#1", "b" }),
+			modified(order, func(e *models.OrderEvent) { e.ID, e.Channel = "e1#2", "c" }),
+		}, ""},
+		{`[with(event, {id: "x"}), with(event, {id: "y"})]`, []models.OrderEvent{
+			modified(order, func(e *models.OrderEvent) { e.ID = "x" }),
+			modified(order, func(e *models.OrderEvent) { e.ID = "y" }),
+		}, ""},
+		{`[]`, []models.OrderEvent{}, ""},
+		{`"paid"`, nil, "unsupported script result string"},
+		{`[event, 1]`, nil, "result[1]: want map"},
+		{`int(status) > 0`, nil, "invalid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			p := newScriptProc(t, map[string]any{"source": tt.src})
+			got, err := p.Process(context.Background(), order)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.EqualFunc(got, tt.want, func(a, b models.OrderEvent) bool {
+				return a.ID == b.ID && a.Status == b.Status && a.Channel == b.Channel && a.Amount == b.Amount &&
+					a.OrderID == b.OrderID && a.TS.Equal(b.TS) && len(a.Attrs) == len(b.Attrs) && a.Attrs["region"] == b.Attrs["region"]
+			}) || (got == nil) != (tt.want == nil) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScriptTimeout(t *testing.T) {
+	p := newScriptProc(t, map[string]any{
+		"source":       `reduce(1..amount*500, #acc + #, 0) > 0`,
+		"timeout":      "1ms",
+		"memoryBudget": 1 << 30,
+	})
+	before := testutil.ToFloat64(scriptRuns.WithLabelValues("inline", "timeout"))
+	if _, err := p.Process(context.Background(), order); !errors.Is(err, errTimeout) {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+	if n := testutil.ToFloat64(scriptRuns.WithLabelValues("inline", "timeout")) - before; n != 1 {
+		t.Fatalf("%v timeouts counted", n)
+	}
+
+	p = newScriptProc(t, map[string]any{"source": `len(map(1..amount*100, #)) > 0`, "memoryBudget": 1000})
+	if _, err := p.Process(context.Background(), order); err == nil || errors.Is(err, errTimeout) {
+		t.Fatalf("err = %v, want the memory budget exceeded", err)
+	}
+}
+
+func TestScriptReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "paid.expr")
+	mtime := time.Now().Add(-time.Hour)
+	write := func(src string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime = mtime.Add(time.Second)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(5 * time.Millisecond) // past the reload interval
+	}
+	var p Processor
+	kept := func() bool {
+		t.Helper()
+		out, err := p.Process(context.Background(), order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(out) == 1
+	}
+
+	write(`status == "paid"`)
+	p = newScriptProc(t, map[string]any{"file": path, "reload": "1ms"})
+	if p.Name() != "script:paid" {
+		t.Fatalf("name %q", p.Name())
+	}
+	if !kept() {
+		t.Fatal("initial script dropped the event")
+	}
+	write(`status == "refunded"`)
+	if kept() {
+		t.Fatal("edit was not picked up")
+	}
+
+	// A broken edit keeps the previous program.
+	before := testutil.ToFloat64(scriptReloads.WithLabelValues("paid", "error"))
+	write(`status ==`)
+	if kept() {
+		t.Fatal("broken edit replaced the running script")
+	}
+	if n := testutil.ToFloat64(scriptReloads.WithLabelValues("paid", "error")) - before; n != 1 {
+		t.Fatalf("%v reload errors counted", n)
+	}
+	write(`true`)
+	if !kept() {
+		t.Fatal("fixed edit was not picked up")
+	}
+}
+
+func TestScriptSpecErrors(t *testing.T) {
+	for _, spec := range []string{
+		`{"type":"script"}`,
+		`{"type":"script","source":"true","file":"x.expr"}`,
+		`{"type":"script","file":"does-not-exist.expr"}`,
+		`{"type":"script","source":"status =="}`,
+		`{"type":"script","source":"price > 10"}`,
+		`{"type":"script","source":"true","timeout":"soon"}`,
+		`{"type":"script","source":"` + strings.Repeat("amount + ", 200) + `1 > 0","maxNodes":100}`,
+	} {
+		if _, err := newScript(json.RawMessage(spec)); err == nil {
+			t.Errorf("%.60s built", spec)
+		}
+	}
+}
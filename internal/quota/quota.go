@@ -0,0 +1,204 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	rejectedCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "quota_rejections_total",
+		Help: "streams refused by a quota",
+	}, []string{"limit"})
+	throttledCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "quota_throttled_events_total",
+		Help: "events delayed by a delivery rate quota",
+	}, []string{"limit"})
+	streamsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "quota_streams",
+		Help: "streams counted against quotas",
+	}, []string{"scope"})
+)
+
+func init() { prometheus.MustRegister(rejectedCtr, throttledCtr, streamsGauge) }
+
+// Limits apply to everything one key (a subject or a tenant) has open;
+// zero means unlimited.
+type Limits struct {
+	Streams int // concurrent SSE/WS streams
+	Rate    int // events per second delivered across those streams
+}
+
+type Config struct {
+	Subject    Limits
+	Tenant     Limits
+	MaxReplay  time.Duration // how far back ?since= / Last-Event-ID may resume; 0 = unlimited
+	RetryAfter time.Duration // suggested to clients refused for too many streams
+}
+
+// Exceeded is returned when a stream is refused; Limit names the quota
+// (subject_streams, tenant_streams).
+type Exceeded struct {
+	Limit      string
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *Exceeded) Error() string { return fmt.Sprintf("quota %s exceeded for %s", e.Limit, e.Key) }
+
+// Manager counts streams and paces delivery per subject and tenant. It is
+// local to the instance: with several replicas each enforces its own share.
+type Manager struct {
+	cfg Config
+
+	mu   sync.Mutex
+	keys map[string]*usage
+}
+
+type usage struct {
+	streams int
+	bucket  *bucket
+}
+
+func New(cfg Config) *Manager {
+	return &Manager{cfg: cfg, keys: make(map[string]*usage)}
+}
+
+// MaxReplay is how far back streams may resume; 0 for no limit.
+func (m *Manager) MaxReplay() time.Duration { return m.cfg.MaxReplay }
+
+// Admit opens a stream for subject (and tenant, when set). The caller must
+// Release the lease.
+func (m *Manager) Admit(subject, tenant string) (*Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l := &Lease{m: m}
+	if tenant != "" {
+		t, err := m.take("tenant", "tenant:"+tenant, m.cfg.Tenant)
+		if err != nil {
+			return nil, err
+		}
+		l.tenant, l.tenantKey = t, "tenant:"+tenant
+	}
+	s, err := m.take("subject", "sub:"+subject, m.cfg.Subject)
+	if err != nil {
+		if l.tenant != nil {
+			m.put("tenant", l.tenantKey)
+		}
+		return nil, err
+	}
+	l.subject, l.subjectKey = s, "sub:"+subject
+	return l, nil
+}
+
+// take counts one more stream for key; m.mu must be held.
+func (m *Manager) take(scope, key string, lim Limits) (*usage, error) {
+	u := m.keys[key]
+	if lim.Streams > 0 && u != nil && u.streams >= lim.Streams {
+		rejectedCtr.WithLabelValues(scope + "_streams").Inc()
+		return nil, &Exceeded{Limit: scope + "_streams", Key: key, RetryAfter: m.cfg.RetryAfter}
+	}
+	if u == nil {
+		u = &usage{}
+		if lim.Rate > 0 {
+			u.bucket = newBucket(lim.Rate)
+		}
+		m.keys[key] = u
+	}
+	u.streams++
+	streamsGauge.WithLabelValues(scope).Inc()
+	return u, nil
+}
+
+// put undoes take; m.mu must be held.
+func (m *Manager) put(scope, key string) {
+	u := m.keys[key]
+	if u == nil {
+		return
+	}
+	if u.streams--; u.streams <= 0 {
+		delete(m.keys, key)
+	}
+	streamsGauge.WithLabelValues(scope).Dec()
+}
+
+// Lease is one admitted stream.
+type Lease struct {
+	m          *Manager
+	subject    *usage
+	tenant     *usage
+	subjectKey string
+	tenantKey  string
+	once       sync.Once
+}
+
+// Wait blocks until the subject and tenant rate quotas allow one more event
+// to be delivered, or ctx ends. Waiting (rather than dropping) lets the
+// stream's buffer fill so its slow-consumer policy decides what is lost.
+func (l *Lease) Wait(ctx context.Context) error {
+	var d time.Duration
+	if b := l.subject.bucket; b != nil {
+		if w := b.reserve(time.Now()); w > 0 {
+			throttledCtr.WithLabelValues("subject_rate").Inc()
+			d = w
+		}
+	}
+	if l.tenant != nil && l.tenant.bucket != nil {
+		if w := l.tenant.bucket.reserve(time.Now()); w > 0 {
+			throttledCtr.WithLabelValues("tenant_rate").Inc()
+			d = max(d, w)
+		}
+	}
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (l *Lease) Release() {
+	l.once.Do(func() {
+		l.m.mu.Lock()
+		defer l.m.mu.Unlock()
+		l.m.put("subject", l.subjectKey)
+		if l.tenant != nil {
+			l.m.put("tenant", l.tenantKey)
+		}
+	})
+}
+
+// bucket is a token bucket holding up to one second of rate. reserve goes
+// into debt instead of failing, so concurrent streams queue fairly.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate int) *bucket {
+	return &bucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
@@ -0,0 +1,121 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAdmit(t *testing.T) {
+	type admit struct {
+		subject, tenant string
+		refused         string // the Exceeded limit, "" when admitted
+	}
+	tests := []struct {
+		name   string
+		cfg    Config
+		admits []admit
+	}{
+		{"unlimited", Config{}, []admit{{"a", "", ""}, {"a", "", ""}, {"a", "t", ""}}},
+		{"subject streams", Config{Subject: Limits{Streams: 2}}, []admit{
+			{"a", "", ""}, {"a", "", ""}, {"a", "", "subject_streams"}, {"b", "", ""},
+		}},
+		{"tenant streams across subjects", Config{Tenant: Limits{Streams: 2}}, []admit{
+			{"a", "t", ""}, {"b", "t", ""}, {"c", "t", "tenant_streams"}, {"c", "u", ""}, {"c", "", ""},
+		}},
+		{"subject refusal frees the tenant slot", Config{Subject: Limits{Streams: 1}, Tenant: Limits{Streams: 2}}, []admit{
+			{"a", "t", ""}, {"a", "t", "subject_streams"}, {"b", "t", ""},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(tt.cfg)
+			for i, a := range tt.admits {
+				l, err := m.Admit(a.subject, a.tenant)
+				var ex *Exceeded
+				switch {
+				case a.refused == "" && err != nil:
+					t.Fatalf("admit #%d (%s/%s): %v", i, a.subject, a.tenant, err)
+				case a.refused != "" && (!errors.As(err, &ex) || ex.Limit != a.refused):
+					t.Fatalf("admit #%d (%s/%s): err = %v, want %s", i, a.subject, a.tenant, err, a.refused)
+				case a.refused == "" && l == nil:
+					t.Fatalf("admit #%d: nil lease", i)
+				}
+			}
+		})
+	}
+}
+
+func TestReleaseFreesSlots(t *testing.T) {
+	m := New(Config{Subject: Limits{Streams: 1}, Tenant: Limits{Streams: 1}, RetryAfter: 7 * time.Second})
+	l, err := m.Admit("a", "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = m.Admit("a", "t")
+	var ex *Exceeded
+	if !errors.As(err, &ex) || ex.RetryAfter != 7*time.Second {
+		t.Fatalf("err = %v, want Exceeded with RetryAfter", err)
+	}
+	l.Release()
+	l.Release() // idempotent: must not free someone else's slot
+	if _, err := m.Admit("a", "t"); err != nil {
+		t.Fatalf("after release: %v", err)
+	}
+	if _, err := m.Admit("a", "t"); err == nil {
+		t.Fatal("double release freed two slots")
+	}
+	if len(m.keys) != 2 {
+		t.Fatalf("%d keys tracked, want 2", len(m.keys))
+	}
+}
+
+func TestBucket(t *testing.T) {
+	start := time.Now()
+	b := &bucket{rate: 2, tokens: 2, last: start}
+	steps := []struct {
+		at   time.Duration
+		want time.Duration
+	}{
+		// A full bucket covers one second's rate, then reserve goes into debt.
+		{0, 0},
+		{0, 0},
+		{0, 500 * time.Millisecond},
+		{0, time.Second},
+		// Two idle seconds refill it, but only up to the rate.
+		{2 * time.Second, 0},
+		{2 * time.Second, 0},
+		{2 * time.Second, 500 * time.Millisecond},
+	}
+	for i, s := range steps {
+		if got := b.reserve(start.Add(s.at)); got != s.want {
+			t.Fatalf("step %d at +%v: wait %v, want %v", i, s.at, got, s.want)
+		}
+	}
+}
+
+func TestWaitPacesAndStopsWithContext(t *testing.T) {
+	m := New(Config{Subject: Limits{Rate: 10}, Tenant: Limits{Rate: 1000}})
+	l, _ := m.Admit("a", "t")
+	defer l.Release()
+	start := time.Now()
+	for range 15 {
+		if err := l.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Ten go through at once, the other five at 10/s.
+	if d := time.Since(start); d < 400*time.Millisecond || d > 2*time.Second {
+		t.Fatalf("15 events at 10/s took %v", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	for range 5 {
+		_ = l.Wait(ctx)
+	}
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v after the context ended", err)
+	}
+}
@@ -0,0 +1,95 @@
+package stream
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"orderpulse-api/internal/models"
+)
+
+const (
+	// DefaultChannel carries events published without a channel and is what
+	// subscribers get unless they ask for others.
+	DefaultChannel = "orders"
+	// AllChannels subscribes to every channel.
+	AllChannels = "*"
+)
+
+var (
+	channelEventsCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "stream_channel_events_total",
+		Help: "events published per channel prefix (the name before ':')",
+	}, []string{"channel"})
+	channelSubsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "stream_channel_subscribers",
+		Help: "subscribers per channel prefix (\"*\" for all-channel subscribers)",
+	}, []string{"channel"})
+)
+
+// maxChannelLabels bounds the label values of the channel metrics, since
+// clients pick channel names.
+const maxChannelLabels = 100
+
+var (
+	channelLabels sync.Map // label -> struct{}
+	channelMu     sync.Mutex
+	channelCount  int
+)
+
+// channelLabel is the metric label for channel c: the part before the
+// first ':' ("merchant" for "merchant:m-42"), or "other" once
+// maxChannelLabels distinct labels are in use.
+func channelLabel(c string) string {
+	if i := strings.IndexByte(c, ':'); i > 0 {
+		c = c[:i]
+	}
+	if _, ok := channelLabels.Load(c); ok {
+		return c
+	}
+	channelMu.Lock()
+	defer channelMu.Unlock()
+	if _, ok := channelLabels.Load(c); ok {
+		return c
+	}
+	if channelCount >= maxChannelLabels {
+		return "other"
+	}
+	channelLabels.Store(c, struct{}{})
+	channelCount++
+	return c
+}
+
+func init() { prometheus.MustRegister(channelEventsCtr, channelSubsGauge) }
+
+// ChannelOf returns ev's channel, DefaultChannel when unset.
+func ChannelOf(ev models.OrderEvent) string {
+	if ev.Channel == "" {
+		return DefaultChannel
+	}
+	return ev.Channel
+}
+
+// channels normalises the filter's channel list: empty means the default
+// channel and a wildcard swallows everything else.
+func (f Filter) channels() []string {
+	if len(f.Channels) == 0 {
+		return []string{DefaultChannel}
+	}
+	for _, c := range f.Channels {
+		if c == AllChannels {
+			return []string{AllChannels}
+		}
+	}
+	return f.Channels
+}
+
+func (f Filter) matchChannel(ev models.OrderEvent) bool {
+	ch := ChannelOf(ev)
+	for _, c := range f.channels() {
+		if c == AllChannels || c == ch {
+			return true
+		}
+	}
+	return false
+}
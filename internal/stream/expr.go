@@ -0,0 +1,54 @@
+package stream
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"orderpulse-api/internal/models"
+)
+
+// exprEnv is what filter expressions see. A struct rather than a map keeps
+// evaluation on the dispatcher cheap.
+type exprEnv struct {
+	ID      string            `expr:"id"`
+	OrderID string            `expr:"orderId"`
+	Type    string            `expr:"type"`
+	Status  string            `expr:"status"`
+	Amount  int               `expr:"amount"`
+	TS      time.Time         `expr:"ts"`
+	Channel string            `expr:"channel"`
+	Late    bool              `expr:"late"`
+	Attrs   map[string]string `expr:"attrs"`
+}
+
+// Expr is a compiled filter expression over an event's fields, e.g.
+//
+//	status in ["failed", "pending"] && amount > 500 && orderId startsWith "a1"
+type Expr struct {
+	src  string
+	prog *vm.Program
+}
+
+// CompileExpr checks src against the event fields; the error shows where
+// it went wrong and is meant to be returned to the client.
+func CompileExpr(src string) (*Expr, error) {
+	prog, err := expr.Compile(src, expr.Env(exprEnv{}), expr.AsBool(), expr.MaxNodes(500))
+	if err != nil {
+		return nil, fmt.Errorf("filter: %w", err)
+	}
+	return &Expr{src: src, prog: prog}, nil
+}
+
+func (e *Expr) String() string { return e.src }
+
+// Match reports whether ev satisfies e; runtime errors count as no match.
+func (e *Expr) Match(ev models.OrderEvent) bool {
+	out, err := vm.Run(e.prog, exprEnv{
+		ID: ev.ID, OrderID: ev.OrderID, Type: ev.Type, Status: ev.Status, Amount: ev.Amount,
+		TS: ev.TS, Channel: ChannelOf(ev), Late: ev.Late, Attrs: ev.Attrs,
+	})
+	ok, _ := out.(bool)
+	return err == nil && ok
+}
@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+var exprEvents = []models.OrderEvent{
+	{ID: "e1", OrderID: "a1-1", Type: "order.created", Status: "pending", Amount: 900},
+	{ID: "e2", OrderID: "b2-1", Type: "status_changed", Status: "failed", Amount: 100},
+	{ID: "e3", OrderID: "a1-2", Type: "status_changed", Status: "failed", Amount: 700, Attrs: map[string]string{"region": "eu"}},
+	{ID: "e4", OrderID: "c3-1", Type: "order.shipped", Status: "shipped", Amount: 50, Channel: "merchant:m-1"},
+}
+
+var exprTests = []struct {
+	src  string
+	want []string
+}{
+	{`status in ["failed", "pending"] && amount > 500 && orderId startsWith "a1"`, []string{"e1", "e3"}},
+	{`amount < 100`, []string{"e4"}},
+	{`attrs.region == "eu"`, []string{"e3"}},
+	{`channel == "orders"`, []string{"e1", "e2", "e3"}},
+	{`type contains "status" || late`, []string{"e2", "e3"}},
+	{`amount % (amount - 100) == 0`, []string{"e4"}}, // e2 divides by zero: no match
+}
+
+func TestCompileExprErrors(t *testing.T) {
+	for _, src := range []string{
+		`amount >`,    // syntax
+		`price > 10`,  // unknown field
+		`amount + 1`,  // not a bool
+		`status == 5`, // mismatched types
+		strings.Repeat("amount > 0 && ", 300) + "true", // too large
+	} {
+		_, err := CompileExpr(src)
+		if err == nil {
+			t.Errorf("%.40q compiled", src)
+			continue
+		}
+		if !strings.HasPrefix(err.Error(), "filter: ") || len(err.Error()) < len("filter: ")+5 {
+			t.Errorf("%.40q: unhelpful error %q", src, err)
+		}
+	}
+}
+
+func TestExprMatch(t *testing.T) {
+	for _, tt := range exprTests {
+		e, err := CompileExpr(tt.src)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.src, err)
+		}
+		var got []string
+		for _, ev := range exprEvents {
+			if e.Match(ev) {
+				got = append(got, ev.ID)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s matched %v, want %v", tt.src, got, tt.want)
+		}
+	}
+}
+
+// SSE and WebSocket build their filter from the query string and
+// subscriptions from JSON (the API body and the saved file); all three must
+// deliver the same events.
+func TestExprSameFromQueryAndJSON(t *testing.T) {
+	for _, tt := range exprTests {
+		t.Run(tt.src, func(t *testing.T) {
+			hub := NewHub(nil)
+			defer hub.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			opts, err := QueryOptions(url.Values{"filter": {tt.src}, "channels": {AllChannels}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			fromQuery := hub.Subscribe(ctx, len(exprEvents), opts...)
+
+			body, _ := json.Marshal(map[string]any{"channels": []string{AllChannels}, "expr": tt.src})
+			var f Filter
+			if err := json.Unmarshal(body, &f); err != nil {
+				t.Fatal(err)
+			}
+			fromJSON := hub.Subscribe(ctx, len(exprEvents), Filtered(f))
+
+			for _, ev := range exprEvents {
+				if err := hub.Publish(ev); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for name, sub := range map[string]Subscriber{"query": fromQuery, "json": fromJSON} {
+				var got []string
+				for range tt.want {
+					select {
+					case ev := <-sub:
+						got = append(got, ev.ID)
+					case <-time.After(5 * time.Second):
+						t.Fatalf("%s: got %v, want %v", name, got, tt.want)
+					}
+				}
+				select {
+				case ev := <-sub:
+					got = append(got, ev.ID)
+				case <-time.After(50 * time.Millisecond):
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Fatalf("%s: got %v, want %v", name, got, tt.want)
+				}
+			}
+		})
+	}
+}
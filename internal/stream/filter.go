@@ -0,0 +1,106 @@
+package stream
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"orderpulse-api/internal/models"
+)
+
+// Filter is the filter used by SSE (?channels=, ?types=, ?statuses=,
+// ?orderIds=, ?filter=) and by server-side consumers; an empty set matches
+// everything, except Channels, which defaults to DefaultChannel. The hub
+// indexes subscribers on the exact-match sets and evaluates Expr, if any, on
+// what the index selects; see Filtered.
+type Filter struct {
+	Channels []string `json:"channels,omitempty"`
+	OrderIDs []string `json:"orderIds,omitempty"`
+	Types    []string `json:"types,omitempty"`
+	Statuses []string `json:"statuses,omitempty"`
+	Expr     string   `json:"expr,omitempty"`
+
+	expr *Expr
+}
+
+func FilterFromQuery(q url.Values) Filter {
+	return Filter{
+		Channels: splitList(q.Get("channels")),
+		OrderIDs: splitList(q.Get("orderIds")),
+		Types:    splitList(q.Get("types")),
+		Statuses: splitList(q.Get("statuses")),
+		Expr:     strings.TrimSpace(q.Get("filter")),
+	}
+}
+
+// Compile checks the channel names and compiles Expr so that callers can
+// reject a bad filter up front; the compiled program travels with f into
+// Filtered.
+func (f *Filter) Compile() error {
+	for _, c := range f.Channels {
+		if c != AllChannels && (c == "" || !models.ValidChannel(c)) {
+			return fmt.Errorf("invalid channel %q", c)
+		}
+	}
+	if f.Expr == "" || f.expr != nil {
+		return nil
+	}
+	e, err := CompileExpr(f.Expr)
+	if err != nil {
+		return err
+	}
+	f.expr = e
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Match reports whether e passes f; an Expr that was not (or could not be)
+// compiled matches nothing.
+func (f Filter) Match(e models.OrderEvent) bool {
+	return f.matchChannel(e) && contains(f.OrderIDs, e.OrderID) && contains(f.Types, e.Type) && contains(f.Statuses, e.Status) &&
+		(f.Expr == "" || f.expr != nil && f.expr.Match(e))
+}
+
+// Filtered delivers only events matching f, compiling f.Expr unless
+// Compile already did.
+func Filtered(f Filter) SubOption {
+	_ = f.Compile()
+	f = Filter{Channels: uniq(f.Channels), OrderIDs: uniq(f.OrderIDs), Types: uniq(f.Types), Statuses: uniq(f.Statuses), Expr: f.Expr, expr: f.expr}
+	return func(o *subOpts) { o.filter = f }
+}
+
+// uniq drops repeats so the index never holds a subscriber twice.
+func uniq(set []string) []string {
+	var out []string
+	for _, s := range set {
+		if !slices.Contains(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Where additionally requires pred to hold. It is evaluated on the
+// subscriber's shard dispatcher, so a slow predicate delays every
+// subscriber on that shard; it must be cheap and must not block.
+func Where(pred func(models.OrderEvent) bool) SubOption {
+	return func(o *subOpts) { o.pred = pred }
+}
+
+func (o *subOpts) match(ev models.OrderEvent) bool {
+	return o.filter.Match(ev) && (o.pred == nil || o.pred(ev))
+}
+
+func contains(set []string, v string) bool {
+	return len(set) == 0 || slices.Contains(set, v)
+}
@@ -6,12 +6,13 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"orderpulse-api/internal/input"
 	"orderpulse-api/internal/models"
 )
 
-type Generator struct{ Hub *Hub }
+type Generator struct{}
 
-func (g *Generator) Run(ctx context.Context) {
+func (g *Generator) Run(ctx context.Context, pub input.Publisher) error {
 	t := time.NewTicker(50 * time.Millisecond)
 	defer t.Stop()
 
@@ -21,7 +22,7 @@ func (g *Generator) Run(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return ctx.Err()
 		case <-t.C:
 			ev := models.OrderEvent{
 				ID:      uuid.NewString(),
@@ -31,7 +32,7 @@ func (g *Generator) Run(ctx context.Context) {
 				Amount:  10 + rand.IntN(990),
 				TS:      time.Now().UTC(),
 			}
-			g.Hub.Publish(ev)
+			_ = pub.Publish(ev)
 		}
 	}
 }
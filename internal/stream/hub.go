@@ -2,7 +2,11 @@ package stream
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"orderpulse-api/internal/logstore"
@@ -11,58 +15,272 @@ import (
 
 type Subscriber chan models.OrderEvent
 
+type subOpts struct {
+	ordered   bool
+	policy    SlowPolicy
+	policySet bool
+	timeout   time.Duration
+	maxWait   time.Duration
+	lag       *Lag
+	cancel    context.CancelFunc
+	done      <-chan struct{}
+	filter    Filter
+	pred      func(models.OrderEvent) bool
+
+	ch     Subscriber
+	shard  *shard
+	mu     sync.RWMutex // held for reading while sending, for writing to close ch
+	closed bool
+}
+
+type SubOption func(*subOpts)
+
+// Ordered subscribes to the timestamp-ordered stream. Without a running
+// reorder buffer it is the same as the arrival-order stream.
+func Ordered() SubOption { return func(o *subOpts) { o.ordered = true } }
+
+var ErrHubClosed = errors.New("stream: hub closed")
+
+// Hub fans events out to subscribers spread over shards. Each shard owns an
+// immutable routing table that Subscribe and unsubscribe replace
+// copy-on-write, and a dispatcher goroutine that delivers from it, so
+// Publish never takes a lock shared with subscriber churn and a slow shard
+// only delays its own subscribers.
 type Hub struct {
-	mu    sync.RWMutex
-	subs  map[Subscriber]struct{}
-	store logstore.Store
+	shards []*shard
+	next   atomic.Uint32
+	done   chan struct{}
+	once   sync.Once
+
+	mu   sync.Mutex // guards subs, used for replay lookups only
+	subs map[Subscriber]*subOpts
+
+	store   logstore.Store
+	reorder *reorderer
+
+	policy       SlowPolicy
+	blockTimeout time.Duration
+	persist      Persistence
+	node         string
+}
+
+// Persistence orders the store append relative to fan-out.
+type Persistence int
+
+const (
+	// FanoutThenPersist delivers immediately and queues the append when the
+	// store supports it; write failures show up in metrics and Health.
+	FanoutThenPersist Persistence = iota
+	// PersistThenFanout waits for the commit and only delivers events that
+	// were stored, so Publish errors mean nobody saw the event.
+	PersistThenFanout
+)
+
+func ParsePersistence(s string) (Persistence, error) {
+	switch s {
+	case "", "fanout-then-persist":
+		return FanoutThenPersist, nil
+	case "persist-then-fanout":
+		return PersistThenFanout, nil
+	}
+	return FanoutThenPersist, fmt.Errorf("unknown persistence mode %q", s)
 }
 
+// SetPersistence must be called before the first Publish.
+func (h *Hub) SetPersistence(p Persistence) { h.persist = p }
+
+// SetNode names this instance in a cluster; Publish stamps it as the origin
+// of events that have none. It must be called before the first Publish.
+func (h *Hub) SetNode(node string) { h.node = node }
+
 func NewHub(store logstore.Store) *Hub {
-	return &Hub{subs: make(map[Subscriber]struct{}), store: store}
+	return NewShardedHub(store, max(4, runtime.GOMAXPROCS(0)))
+}
+
+// NewShardedHub is NewHub with an explicit shard (dispatcher) count.
+func NewShardedHub(store logstore.Store, shards int) *Hub {
+	h := &Hub{
+		subs:         make(map[Subscriber]*subOpts),
+		done:         make(chan struct{}),
+		store:        store,
+		blockTimeout: 100 * time.Millisecond,
+	}
+	for range max(shards, 1) {
+		s := newShard(64)
+		h.shards = append(h.shards, s)
+		go s.run(h.done)
+	}
+	return h
+}
+
+// Close stops the dispatchers; later Publish calls return ErrHubClosed.
+func (h *Hub) Close() { h.once.Do(func() { close(h.done) }) }
+
+// SetSlowPolicy sets the policy for subscribers that do not pick one.
+func (h *Hub) SetSlowPolicy(p SlowPolicy, blockTimeout time.Duration) {
+	h.policy = p
+	if blockTimeout > 0 {
+		h.blockTimeout = blockTimeout
+	}
+}
+
+// StartReorder enables the ordered stream; it must be called before the
+// first Publish.
+func (h *Hub) StartReorder(ctx context.Context, lateness time.Duration, policy LatePolicy) {
+	h.reorder = &reorderer{
+		lateness: lateness,
+		policy:   policy,
+		in:       make(chan models.OrderEvent, 4096),
+		done:     make(chan struct{}),
+		emit:     func(ev models.OrderEvent) { _ = h.fanout(ev, true) },
+	}
+	go h.reorder.run(ctx)
 }
 
-func (h *Hub) Subscribe(ctx context.Context, buf int) Subscriber {
-	ch := make(Subscriber, buf)
+func (h *Hub) Subscribe(ctx context.Context, buf int, opts ...SubOption) Subscriber {
+	o := &subOpts{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if h.reorder == nil {
+		o.ordered = false
+	}
+	if !o.policySet {
+		o.policy = h.policy
+	}
+	if o.timeout <= 0 {
+		o.timeout = h.blockTimeout
+	}
+	if o.maxWait > 0 {
+		o.timeout = min(o.timeout, o.maxWait)
+	}
+	if o.lag == nil {
+		o.lag = &Lag{}
+	}
+	ctx, o.cancel = context.WithCancel(ctx)
+	o.done = ctx.Done()
+	o.ch = make(Subscriber, buf)
+	o.shard = h.shards[int(h.next.Add(1))%len(h.shards)]
+
 	h.mu.Lock()
-	h.subs[ch] = struct{}{}
+	h.subs[o.ch] = o
 	h.mu.Unlock()
+	o.shard.update(func(t *table) { t.add(o) })
 	subsGauge.Inc()
+	for _, c := range o.filter.channels() {
+		channelSubsGauge.WithLabelValues(channelLabel(c)).Inc()
+	}
 
 	go func() {
 		<-ctx.Done()
+		o.shard.update(func(t *table) { t.remove(o) })
 		h.mu.Lock()
-		delete(h.subs, ch)
-		close(ch)
+		delete(h.subs, o.ch)
 		h.mu.Unlock()
+		// A dispatcher may still hold the old table; closed stops it from
+		// sending once the channel is gone.
+		o.mu.Lock()
+		o.closed = true
+		close(o.ch)
+		o.mu.Unlock()
 		subsGauge.Dec()
+		for _, c := range o.filter.channels() {
+			channelSubsGauge.WithLabelValues(channelLabel(c)).Dec()
+		}
 	}()
-	return ch
+	return o.ch
+}
+
+// enqueuer is implemented by stores with an asynchronous append path, such
+// as logstore.Writer.
+type enqueuer interface {
+	Enqueue(models.OrderEvent) error
 }
 
-func (h *Hub) Publish(ev models.OrderEvent) {
-	h.mu.RLock()
-	for ch := range h.subs {
+func (h *Hub) Publish(ev models.OrderEvent) error { return h.publish(ev, false) }
+
+// PublishDurable is Publish that only returns once ev is committed to the
+// store, even under FanoutThenPersist. Sources that ack upstream when it
+// returns use it (see input.Acker).
+func (h *Hub) PublishDurable(ev models.OrderEvent) error { return h.publish(ev, true) }
+
+func (h *Hub) publish(ev models.OrderEvent, durable bool) error {
+	if !models.ValidChannel(ev.Channel) {
+		return fmt.Errorf("stream: invalid channel %q", ev.Channel)
+	}
+	if ev.Origin == "" {
+		ev.Origin = h.node
+	}
+	ev.Wire = &models.Wire{}
+	if h.persist == PersistThenFanout && h.store != nil {
+		if err := h.store.Append(ev); err != nil {
+			return err
+		}
+	}
+	channelEventsCtr.WithLabelValues(channelLabel(ChannelOf(ev))).Inc()
+	if err := h.fanout(ev, false); err != nil {
+		return err
+	}
+	if h.reorder != nil {
+		h.reorder.push(ev)
+	}
+	if h.persist == FanoutThenPersist && h.store != nil {
+		if q, ok := h.store.(enqueuer); ok && !durable {
+			return q.Enqueue(ev)
+		}
+		return h.store.Append(ev)
+	}
+	return nil
+}
+
+// Health reports the store's health; nil without a store.
+func (h *Hub) Health() error {
+	if h.store == nil {
+		return nil
+	}
+	return h.store.Health()
+}
+
+// fanout hands ev to every shard that has subscribers; it blocks only when
+// a shard's queue is full.
+func (h *Hub) fanout(ev models.OrderEvent, ordered bool) error {
+	for _, s := range h.shards {
+		if s.tbl.Load().n == 0 {
+			continue
+		}
 		select {
-		case ch <- ev:
-		default:
-			dropsCtr.Inc()
+		case s.queue <- dispatch{ev: ev, ordered: ordered}:
+		case <-h.done:
+			return ErrHubClosed
 		}
 	}
-	h.mu.RUnlock()
-	if h.store != nil {
-		_ = h.store.Append(ev)
+	return nil
+}
+
+func idxOf(ordered bool) int {
+	if ordered {
+		return 1
 	}
+	return 0
 }
 
+// ReplaySince feeds out the stored events after since that match its
+// filter. Replay is not subject to the slow-consumer policy: it waits for
+// room in the buffer, so callers run it alongside the loop reading out and
+// it returns early once the subscription ends.
 func (h *Hub) ReplaySince(since time.Time, out Subscriber) {
 	if h.store == nil {
 		return
 	}
+	h.mu.Lock()
+	o := h.subs[out]
+	h.mu.Unlock()
+	if o == nil {
+		return
+	}
 	_ = h.store.ReplaySince(since, func(ev models.OrderEvent) bool {
-		select {
-		case out <- ev:
-		default:
-			dropsCtr.Inc()
+		if o.match(ev) {
+			return o.replay(ev)
 		}
 		return true
 	})
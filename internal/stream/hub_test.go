@@ -0,0 +1,128 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+// BenchmarkHubFanout measures Publish through to delivery on every
+// subscriber: one op is one event seen by all of them. Subscribers use
+// Block so nothing is dropped, and half of them filter on a status that
+// only every other event has, so the index has subscribers to skip.
+func BenchmarkHubFanout(b *testing.B) {
+	for _, subs := range []int{10, 1000, 10000} {
+		b.Run(fmt.Sprintf("subs=%d", subs), func(b *testing.B) {
+			hub := NewHub(nil)
+			defer hub.Close()
+			ctx, cancel := context.WithCancel(context.Background())
+			var (
+				wg        sync.WaitGroup
+				delivered atomic.Int64
+			)
+			for i := range subs {
+				f := Filter{}
+				if i%2 == 1 {
+					f.Statuses = []string{"paid"}
+				}
+				ch := hub.Subscribe(ctx, 256, Filtered(f), Policy(Block, time.Minute))
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range ch {
+						delivered.Add(1)
+					}
+				}()
+			}
+			statuses := [2]string{"paid", "pending"}
+			want := int64(0)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := range b.N {
+				ev := models.OrderEvent{ID: fmt.Sprint(i), OrderID: "o-1", Status: statuses[i%2], TS: time.Now()}
+				if err := hub.Publish(ev); err != nil {
+					b.Fatal(err)
+				}
+				if i%2 == 0 {
+					want += int64(subs)
+				} else {
+					want += int64(subs / 2)
+				}
+			}
+			for delivered.Load() < want {
+				time.Sleep(50 * time.Microsecond)
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(want)/b.Elapsed().Seconds(), "deliveries/s")
+			cancel()
+			wg.Wait()
+		})
+	}
+}
+
+// Subscribers leaving while events are being dispatched must not make a
+// dispatcher send on a closed channel, and must leave nothing behind.
+func TestUnsubscribeDuringPublish(t *testing.T) {
+	hub := NewHub(nil)
+	defer hub.Close()
+	stop := make(chan struct{})
+	var pubs sync.WaitGroup
+	pubs.Add(1)
+	go func() {
+		defer pubs.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = hub.Publish(models.OrderEvent{ID: fmt.Sprint(i), OrderID: "o-1", Status: "paid"})
+		}
+	}()
+
+	var subs sync.WaitGroup
+	for i := range 200 {
+		ctx, cancel := context.WithCancel(context.Background())
+		f := Filter{}
+		if i%2 == 1 {
+			f.Statuses = []string{"paid"}
+		}
+		ch := hub.Subscribe(ctx, 4, Filtered(f), Policy(DropOldest, 0))
+		subs.Add(1)
+		go func() {
+			defer subs.Done()
+			time.Sleep(time.Duration(i%10) * time.Millisecond)
+			cancel()
+			// The channel must close once, after which range ends.
+			for range ch {
+			}
+		}()
+	}
+	subs.Wait()
+	close(stop)
+	pubs.Wait()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hub.mu.Lock()
+		left := len(hub.subs)
+		hub.mu.Unlock()
+		n := 0
+		for _, s := range hub.shards {
+			n += s.tbl.Load().n
+		}
+		if left == 0 && n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d subscribers registered and %d routed after all left", left, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,112 @@
+package stream
+
+import "orderpulse-api/internal/models"
+
+// subSet is copied on every change, so a slice is cheaper than a map both to
+// copy and to iterate.
+type subSet []*subOpts
+
+// index routes an event to the subscribers that can match it. A filtered
+// subscriber is keyed on its most selective dimension (order ID, then type,
+// then status); the remaining dimensions and any predicate are checked per
+// candidate. Subscribers without a usable key go in all.
+type index struct {
+	all      subSet
+	byOrder  map[string]subSet
+	byType   map[string]subSet
+	byStatus map[string]subSet
+}
+
+func newIndex() *index {
+	return &index{byOrder: map[string]subSet{}, byType: map[string]subSet{}, byStatus: map[string]subSet{}}
+}
+
+// clone copies the top-level maps; add and remove copy any set they touch,
+// so a published index is never mutated.
+func (x *index) clone() *index {
+	c := &index{all: x.all, byOrder: make(map[string]subSet, len(x.byOrder)),
+		byType: make(map[string]subSet, len(x.byType)), byStatus: make(map[string]subSet, len(x.byStatus))}
+	for k, v := range x.byOrder {
+		c.byOrder[k] = v
+	}
+	for k, v := range x.byType {
+		c.byType[k] = v
+	}
+	for k, v := range x.byStatus {
+		c.byStatus[k] = v
+	}
+	return c
+}
+
+func (set subSet) with(o *subOpts) subSet {
+	c := make(subSet, len(set), len(set)+1)
+	copy(c, set)
+	return append(c, o)
+}
+
+func (set subSet) without(o *subOpts) subSet {
+	c := make(subSet, 0, len(set))
+	for _, x := range set {
+		if x != o {
+			c = append(c, x)
+		}
+	}
+	return c
+}
+
+func (x *index) empty() bool {
+	return len(x.all) == 0 && len(x.byOrder) == 0 && len(x.byType) == 0 && len(x.byStatus) == 0
+}
+
+func (x *index) key(o *subOpts) (map[string]subSet, []string) {
+	switch {
+	case len(o.filter.OrderIDs) > 0:
+		return x.byOrder, o.filter.OrderIDs
+	case len(o.filter.Types) > 0:
+		return x.byType, o.filter.Types
+	case len(o.filter.Statuses) > 0:
+		return x.byStatus, o.filter.Statuses
+	}
+	return nil, nil
+}
+
+func (x *index) add(o *subOpts) {
+	m, keys := x.key(o)
+	if m == nil {
+		x.all = x.all.with(o)
+		return
+	}
+	for _, k := range keys {
+		m[k] = m[k].with(o)
+	}
+}
+
+func (x *index) remove(o *subOpts) {
+	m, keys := x.key(o)
+	if m == nil {
+		x.all = x.all.without(o)
+		return
+	}
+	for _, k := range keys {
+		if m[k] = m[k].without(o); len(m[k]) == 0 {
+			delete(m, k)
+		}
+	}
+}
+
+// each calls fn for every subscriber whose filter matches ev. A subscriber
+// lives under one dimension and an event has one value per dimension, so
+// nobody is visited twice.
+func (x *index) each(ev models.OrderEvent, fn func(*subOpts)) {
+	visit := func(set subSet) {
+		for _, o := range set {
+			if o.match(ev) {
+				fn(o)
+			}
+		}
+	}
+	visit(x.all)
+	visit(x.byOrder[ev.OrderID])
+	visit(x.byType[ev.Type])
+	visit(x.byStatus[ev.Status])
+}
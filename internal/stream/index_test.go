@@ -0,0 +1,162 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+var (
+	testChannels = []string{"", "orders", "merchant:m-1", "merchant:m-2"}
+	testOrders   = []string{"o-1", "o-2", "o-3"}
+	testTypes    = []string{"order.created", "order.shipped", "status_changed"}
+	testStatuses = []string{"pending", "paid", "shipped"}
+)
+
+// pick returns up to three values from set, possibly repeated, or none.
+func pick(r *rand.Rand, set []string) []string {
+	var out []string
+	for range r.IntN(4) {
+		out = append(out, set[r.IntN(len(set))])
+	}
+	return out
+}
+
+func randomSub(r *rand.Rand) *subOpts {
+	f := Filter{Channels: pick(r, testChannels[1:]), OrderIDs: pick(r, testOrders), Types: pick(r, testTypes), Statuses: pick(r, testStatuses)}
+	if r.IntN(8) == 0 {
+		f.Channels = append(f.Channels, AllChannels)
+	}
+	o := &subOpts{ordered: r.IntN(4) == 0}
+	Filtered(f)(o)
+	if r.IntN(5) == 0 {
+		// A predicate the index cannot see.
+		Where(func(ev models.OrderEvent) bool { return ev.Amount%2 == 0 })(o)
+	}
+	return o
+}
+
+func randomEvent(r *rand.Rand) models.OrderEvent {
+	return models.OrderEvent{
+		Channel: testChannels[r.IntN(len(testChannels))],
+		OrderID: testOrders[r.IntN(len(testOrders))],
+		Type:    testTypes[r.IntN(len(testTypes))],
+		Status:  testStatuses[r.IntN(len(testStatuses))],
+		Amount:  r.IntN(10),
+	}
+}
+
+// checkAgainstScan compares the table's routing with matching every live
+// subscriber in turn.
+func checkAgainstScan(t *testing.T, r *rand.Rand, tbl *table, live []*subOpts) {
+	t.Helper()
+	for range 500 {
+		ev := randomEvent(r)
+		ordered := r.IntN(2) == 0
+		visits := map[*subOpts]int{}
+		tbl.each(ev, ordered, func(o *subOpts) { visits[o]++ })
+		for _, o := range live {
+			want := 0
+			if o.ordered == ordered && o.match(ev) {
+				want = 1
+			}
+			if visits[o] != want {
+				t.Fatalf("event %+v (ordered %v): %+v visited %d times, want %d", ev, ordered, o.filter, visits[o], want)
+			}
+			delete(visits, o)
+		}
+		if len(visits) > 0 {
+			t.Fatalf("event %+v visited %d removed subscribers", ev, len(visits))
+		}
+	}
+}
+
+func TestIndexMatchesLinearScan(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	tbl := &table{idx: [2]map[string]*index{{}, {}}}
+	var live []*subOpts
+	for range 300 {
+		o := randomSub(r)
+		tbl.add(o)
+		live = append(live, o)
+	}
+	// Subscribers with no filter at all sit in the index's catch-all set.
+	for range 3 {
+		o := &subOpts{}
+		Filtered(Filter{})(o)
+		tbl.add(o)
+		live = append(live, o)
+	}
+	checkAgainstScan(t, r, tbl, live)
+
+	r.Shuffle(len(live), func(i, j int) { live[i], live[j] = live[j], live[i] })
+	for _, o := range live[:len(live)/2] {
+		tbl.remove(o)
+	}
+	live = live[len(live)/2:]
+	checkAgainstScan(t, r, tbl, live)
+
+	for _, o := range live {
+		tbl.remove(o)
+	}
+	if tbl.n != 0 || len(tbl.idx[0]) != 0 || len(tbl.idx[1]) != 0 {
+		t.Fatalf("empty table still holds %d subscribers, %d+%d channels", tbl.n, len(tbl.idx[0]), len(tbl.idx[1]))
+	}
+}
+
+// TestHubDeliversWhatFiltersMatch runs the same comparison end to end
+// through the shards.
+func TestHubDeliversWhatFiltersMatch(t *testing.T) {
+	r := rand.New(rand.NewPCG(3, 4))
+	hub := NewHub(nil)
+	defer hub.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	const nEvents = 300
+	type sub struct {
+		f  Filter
+		ch Subscriber
+	}
+	subs := make([]sub, 100)
+	for i := range subs {
+		o := randomSub(r)
+		subs[i] = sub{o.filter, hub.Subscribe(ctx, nEvents, Filtered(o.filter))}
+	}
+	var events []models.OrderEvent
+	for i := range nEvents {
+		ev := randomEvent(r)
+		ev.ID = fmt.Sprint("e", i)
+		events = append(events, ev)
+		if err := hub.Publish(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, s := range subs {
+		var want []string
+		for _, ev := range events {
+			if s.f.Match(ev) {
+				want = append(want, ev.ID)
+			}
+		}
+		for _, id := range want {
+			select {
+			case ev := <-s.ch:
+				if ev.ID != id {
+					t.Fatalf("%+v got %s, want %s", s.f, ev.ID, id)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%+v never got %s", s.f, id)
+			}
+		}
+		select {
+		case ev := <-s.ch:
+			t.Fatalf("%+v got %s, which it does not match", s.f, ev.ID)
+		default:
+		}
+	}
+}
@@ -11,6 +11,10 @@ var (
 		Name: "stream_dropped_messages_total",
 		Help: "messages dropped due to backpressure",
 	})
+	laggedCtr = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "stream_lagged_disconnects_total",
+		Help: "subscribers disconnected by the disconnect slow-consumer policy",
+	})
 )
 
-func init() { prometheus.MustRegister(subsGauge, dropsCtr) }
+func init() { prometheus.MustRegister(subsGauge, dropsCtr, laggedCtr) }
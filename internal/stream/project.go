@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"orderpulse-api/internal/models"
+)
+
+// projectable lists the fields a projection can select, in the order
+// compact payloads use when no fields are given.
+var projectable = []string{"id", "orderId", "type", "status", "amount", "ts", "late", "channel", "origin", "attrs"}
+
+// Projection decides what a stream client receives for each event: the
+// full event, or only fields (?fields=orderId,status), as a JSON object or,
+// with ?encoding=compact, as an array of values in field order with ts in
+// Unix milliseconds. Payloads are cached on the event's Wire, so each
+// distinct projection is encoded once per event.
+type Projection struct {
+	fields  []string
+	compact bool
+	key     string
+}
+
+func ParseProjection(fields, encoding string) (Projection, error) {
+	var p Projection
+	for _, f := range splitList(fields) {
+		if !slices.Contains(projectable, f) {
+			return p, fmt.Errorf("unknown field %q (want %s)", f, strings.Join(projectable, ", "))
+		}
+		if !slices.Contains(p.fields, f) {
+			p.fields = append(p.fields, f)
+		}
+	}
+	switch encoding {
+	case "", "json":
+	case "compact":
+		p.compact = true
+		if len(p.fields) == 0 {
+			p.fields = projectable
+		}
+	default:
+		return p, fmt.Errorf("unknown encoding %q (want json or compact)", encoding)
+	}
+	p.key = strings.Join(p.fields, ",")
+	if p.compact {
+		p.key = "compact:" + p.key
+	}
+	return p, nil
+}
+
+// ProjectionFromQuery reads ?fields= and ?encoding=.
+func ProjectionFromQuery(q url.Values) (Projection, error) {
+	return ParseProjection(q.Get("fields"), q.Get("encoding"))
+}
+
+// Encode returns ev's payload under p. Callers must not modify it.
+func (p Projection) Encode(ev models.OrderEvent) []byte {
+	return ev.Wire.Load(p.cacheKey("json", ev), func() any { return p.encode(ev) }).([]byte)
+}
+
+// Cached returns build(payload) for ev under p, built once per event and
+// format (e.g. an SSE frame or a prepared WebSocket message) and shared by
+// every connection using the same projection.
+func (p Projection) Cached(ev models.OrderEvent, format string, build func(payload []byte) any) any {
+	return ev.Wire.Load(p.cacheKey(format, ev), func() any { return build(p.Encode(ev)) })
+}
+
+func (p Projection) cacheKey(format string, ev models.OrderEvent) string {
+	key := format + ":" + p.key
+	if ev.Late {
+		// The reorderer tags late copies of an event that shares its Wire.
+		key += ":late"
+	}
+	return key
+}
+
+func (p Projection) encode(ev models.OrderEvent) []byte {
+	if len(p.fields) == 0 {
+		b, _ := json.Marshal(ev)
+		return b
+	}
+	start, end := byte('{'), byte('}')
+	if p.compact {
+		start, end = '[', ']'
+	}
+	b := []byte{start}
+	for i, f := range p.fields {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if !p.compact {
+			b = append(b, '"')
+			b = append(b, f...)
+			b = append(b, '"', ':')
+		}
+		v, _ := json.Marshal(p.value(ev, f))
+		b = append(b, v...)
+	}
+	return append(b, end)
+}
+
+func (p Projection) value(ev models.OrderEvent, field string) any {
+	switch field {
+	case "id":
+		return ev.ID
+	case "orderId":
+		return ev.OrderID
+	case "type":
+		return ev.Type
+	case "status":
+		return ev.Status
+	case "amount":
+		return ev.Amount
+	case "ts":
+		if p.compact {
+			return ev.TS.UnixMilli()
+		}
+		return ev.TS
+	case "late":
+		return ev.Late
+	case "channel":
+		return ChannelOf(ev)
+	case "origin":
+		return ev.Origin
+	case "attrs":
+		return ev.Attrs
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package stream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+// BenchmarkSSEFrame frames one event for 100 connections per op, either
+// through the event's shared Wire cache or encoding per connection (a nil
+// Wire caches nothing), under each kind of projection.
+func BenchmarkSSEFrame(b *testing.B) {
+	const conns = 100
+	projections := []struct{ name, fields, encoding string }{
+		{"full", "", ""},
+		{"fields", "orderId,status", ""},
+		{"compact", "", "compact"},
+	}
+	for _, p := range projections {
+		proj, err := ParseProjection(p.fields, p.encoding)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, shared := range []bool{false, true} {
+			mode := "per-connection"
+			if shared {
+				mode = "shared"
+			}
+			b.Run(fmt.Sprintf("%s/%s", p.name, mode), func(b *testing.B) {
+				ev := models.OrderEvent{
+					ID: "e1", OrderID: "o-1", Type: "status_changed", Status: "paid", Amount: 100,
+					TS: time.Now(), Attrs: map[string]string{"merchant": "m-42"},
+				}
+				b.ReportAllocs()
+				for range b.N {
+					ev.Wire = nil
+					if shared {
+						ev.Wire = &models.Wire{}
+					}
+					for range conns {
+						if len(SSEFrame(proj, ev)) == 0 {
+							b.Fatal("empty frame")
+						}
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestSSEFrameSharedMatchesPerConnection(t *testing.T) {
+	ev := models.OrderEvent{ID: "e1", OrderID: "o-1", Status: "paid", Channel: "alerts", TS: time.Unix(0, 42)}
+	for _, enc := range []string{"", "compact"} {
+		proj, err := ParseProjection("orderId,status,ts", enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ev.Wire = nil
+		want := string(SSEFrame(proj, ev))
+		ev.Wire = &models.Wire{}
+		first, second := SSEFrame(proj, ev), SSEFrame(proj, ev)
+		if string(first) != want || &first[0] != &second[0] {
+			t.Fatalf("%q: shared frame %q (reused %v), want %q", enc, first, &first[0] == &second[0], want)
+		}
+	}
+}
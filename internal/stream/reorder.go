@@ -0,0 +1,115 @@
+package stream
+
+import (
+	"container/heap"
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"orderpulse-api/internal/models"
+)
+
+type LatePolicy string
+
+const (
+	// LateTag delivers late events immediately to ordered subscribers with
+	// Late set, so they can be told apart.
+	LateTag LatePolicy = "tag"
+	// LateDrop discards them from the ordered stream; raw subscribers and the
+	// log still get them.
+	LateDrop LatePolicy = "drop"
+)
+
+var (
+	lateCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "stream_late_events_total",
+		Help: "events that arrived behind the reorder watermark",
+	}, []string{"policy"})
+	bufferedGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "stream_reorder_buffered",
+		Help: "events held in the reorder buffer",
+	})
+)
+
+func init() { prometheus.MustRegister(lateCtr, bufferedGauge) }
+
+type eventHeap []models.OrderEvent
+
+func (h eventHeap) Len() int           { return len(h) }
+func (h eventHeap) Less(i, j int) bool { return h[i].TS.Before(h[j].TS) }
+func (h eventHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *eventHeap) Push(x any)        { *h = append(*h, x.(models.OrderEvent)) }
+func (h *eventHeap) Pop() any {
+	old := *h
+	ev := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return ev
+}
+
+// reorderer holds events until the watermark (highest TS seen minus the
+// allowed lateness) passes them, then emits them in TS order. If nothing
+// arrives for a full lateness period the buffer is flushed.
+type reorderer struct {
+	lateness time.Duration
+	policy   LatePolicy
+	in       chan models.OrderEvent
+	done     chan struct{}
+	emit     func(models.OrderEvent)
+}
+
+func (r *reorderer) push(ev models.OrderEvent) {
+	select {
+	case r.in <- ev:
+	case <-r.done:
+	}
+}
+
+func (r *reorderer) run(ctx context.Context) {
+	defer close(r.done)
+	var (
+		buf       eventHeap
+		maxTS     time.Time
+		watermark time.Time
+		lastIn    time.Time
+	)
+	tick := time.NewTicker(max(r.lateness/4, 10*time.Millisecond))
+	defer tick.Stop()
+
+	release := func(upTo time.Time, all bool) {
+		for buf.Len() > 0 && (all || !buf[0].TS.After(upTo)) {
+			ev := heap.Pop(&buf).(models.OrderEvent)
+			if ev.TS.After(watermark) {
+				watermark = ev.TS
+			}
+			r.emit(ev)
+		}
+		bufferedGauge.Set(float64(buf.Len()))
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			release(time.Time{}, true)
+			return
+		case ev := <-r.in:
+			lastIn = time.Now()
+			if !watermark.IsZero() && ev.TS.Before(watermark) {
+				lateCtr.WithLabelValues(string(r.policy)).Inc()
+				if r.policy == LateTag {
+					ev.Late = true
+					r.emit(ev)
+				}
+				continue
+			}
+			heap.Push(&buf, ev)
+			if ev.TS.After(maxTS) {
+				maxTS = ev.TS
+			}
+			release(maxTS.Add(-r.lateness), false)
+		case <-tick.C:
+			if buf.Len() > 0 && time.Since(lastIn) >= r.lateness {
+				release(time.Time{}, true)
+			}
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package stream
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"orderpulse-api/internal/models"
+)
+
+// startReorderer runs a reorderer whose output is collected on the
+// returned channel; cancel flushes and stops it.
+func startReorderer(t *testing.T, lateness time.Duration, policy LatePolicy) (*reorderer, <-chan models.OrderEvent, context.CancelFunc) {
+	t.Helper()
+	out := make(chan models.OrderEvent, 64)
+	r := &reorderer{
+		lateness: lateness,
+		policy:   policy,
+		in:       make(chan models.OrderEvent, 64),
+		done:     make(chan struct{}),
+		emit:     func(ev models.OrderEvent) { out <- ev },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go r.run(ctx)
+	t.Cleanup(func() {
+		cancel()
+		<-r.done
+	})
+	return r, out, cancel
+}
+
+// at is an event stamped d after a fixed base time.
+func at(id string, d time.Duration) models.OrderEvent {
+	return models.OrderEvent{ID: id, OrderID: "o-1", TS: time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC).Add(d)}
+}
+
+func receive(t *testing.T, out <-chan models.OrderEvent, n int) []models.OrderEvent {
+	t.Helper()
+	var got []models.OrderEvent
+	for range n {
+		select {
+		case ev := <-out:
+			got = append(got, ev)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d of %d events", len(got), n)
+		}
+	}
+	return got
+}
+
+func ids(evs []models.OrderEvent) []string {
+	var s []string
+	for _, ev := range evs {
+		s = append(s, ev.ID)
+	}
+	return s
+}
+
+func quiet(t *testing.T, out <-chan models.OrderEvent) {
+	t.Helper()
+	select {
+	case ev := <-out:
+		t.Fatalf("unexpected %s", ev.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestReorderReleasesBehindWatermark(t *testing.T) {
+	r, out, cancel := startReorderer(t, time.Hour, LateTag)
+	r.push(at("c", 3*time.Second))
+	r.push(at("a", time.Second))
+	r.push(at("b", 2*time.Second))
+	quiet(t, out) // nothing is an hour behind the newest event yet
+
+	// The watermark moves to +5s and releases everything at or before it.
+	r.push(at("d", time.Hour+5*time.Second))
+	if got := ids(receive(t, out, 3)); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Fatalf("released %v", got)
+	}
+	quiet(t, out)
+
+	// Stopping flushes what is still held.
+	r.push(at("e", time.Hour+4*time.Second))
+	cancel()
+	if got := ids(receive(t, out, 2)); !slices.Equal(got, []string{"e", "d"}) {
+		t.Fatalf("flushed %v", got)
+	}
+	<-r.done
+	r.push(at("f", 0)) // must not block once stopped
+}
+
+func TestReorderLateEvents(t *testing.T) {
+	for _, policy := range []LatePolicy{LateTag, LateDrop} {
+		t.Run(string(policy), func(t *testing.T) {
+			before := testutil.ToFloat64(lateCtr.WithLabelValues(string(policy)))
+			r, out, _ := startReorderer(t, 0, policy)
+			r.push(at("a", 2*time.Second))
+			r.push(at("b", 2*time.Second)) // level with the watermark: on time
+			r.push(at("late", time.Second))
+			r.push(at("c", 3*time.Second))
+
+			want := []string{"a", "b", "late", "c"}
+			if policy == LateDrop {
+				want = []string{"a", "b", "c"}
+			}
+			got := receive(t, out, len(want))
+			if !slices.Equal(ids(got), want) {
+				t.Fatalf("emitted %v, want %v", ids(got), want)
+			}
+			for _, ev := range got {
+				if ev.Late != (ev.ID == "late") {
+					t.Fatalf("%s: Late = %v", ev.ID, ev.Late)
+				}
+			}
+			if n := testutil.ToFloat64(lateCtr.WithLabelValues(string(policy))) - before; n != 1 {
+				t.Fatalf("%v late events counted", n)
+			}
+		})
+	}
+}
+
+func TestReorderFlushesWhenIdle(t *testing.T) {
+	const lateness = 100 * time.Millisecond
+	r, out, _ := startReorderer(t, lateness, LateTag)
+	start := time.Now()
+	r.push(at("b", 50*time.Millisecond))
+	r.push(at("a", 0))
+	got := receive(t, out, 2)
+	if d := time.Since(start); d < lateness {
+		t.Fatalf("flushed after %v, before a full lateness period", d)
+	}
+	if !slices.Equal(ids(got), []string{"a", "b"}) {
+		t.Fatalf("flushed %v", ids(got))
+	}
+}
+
+// Ordered subscribers get the reordered stream while the others keep
+// arrival order.
+func TestHubOrderedSubscribers(t *testing.T) {
+	hub := NewHub(nil)
+	defer hub.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub.StartReorder(ctx, 50*time.Millisecond, LateTag)
+	ordered := hub.Subscribe(ctx, 8, Ordered())
+	raw := hub.Subscribe(ctx, 8)
+
+	for _, ev := range []models.OrderEvent{at("b", 20*time.Millisecond), at("c", 30*time.Millisecond), at("a", 0)} {
+		if err := hub.Publish(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, tt := range map[string]struct {
+		sub  Subscriber
+		want []string
+	}{
+		"ordered": {ordered, []string{"a", "b", "c"}},
+		"raw":     {raw, []string{"b", "c", "a"}},
+	} {
+		if got := ids(receive(t, tt.sub, 3)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s got %v, want %v", name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package stream
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+type dispatch struct {
+	ev      models.OrderEvent
+	ordered bool
+}
+
+// table is a shard's routing snapshot, one index per channel for each of the
+// arrival- and timestamp-ordered streams. It is never modified once
+// published: update copies the maps and add/remove copy the index they touch.
+type table struct {
+	idx [2]map[string]*index
+	n   int
+}
+
+func (t *table) clone() *table {
+	c := &table{n: t.n}
+	for i, m := range t.idx {
+		c.idx[i] = make(map[string]*index, len(m))
+		for k, v := range m {
+			c.idx[i][k] = v
+		}
+	}
+	return c
+}
+
+func (t *table) add(o *subOpts) {
+	m := t.idx[idxOf(o.ordered)]
+	for _, c := range o.filter.channels() {
+		x := newIndex()
+		if old := m[c]; old != nil {
+			x = old.clone()
+		}
+		x.add(o)
+		m[c] = x
+	}
+	t.n++
+}
+
+func (t *table) remove(o *subOpts) {
+	m := t.idx[idxOf(o.ordered)]
+	for _, c := range o.filter.channels() {
+		if old := m[c]; old != nil {
+			x := old.clone()
+			x.remove(o)
+			if x.empty() {
+				delete(m, c)
+			} else {
+				m[c] = x
+			}
+		}
+	}
+	t.n--
+}
+
+// each visits matching subscribers of ev's channel and of the wildcard; a
+// subscriber is in one or the other, never both.
+func (t *table) each(ev models.OrderEvent, ordered bool, fn func(*subOpts)) {
+	m := t.idx[idxOf(ordered)]
+	if x := m[ChannelOf(ev)]; x != nil {
+		x.each(ev, fn)
+	}
+	if x := m[AllChannels]; x != nil {
+		x.each(ev, fn)
+	}
+}
+
+type shard struct {
+	mu    sync.Mutex // serialises table writers
+	tbl   atomic.Pointer[table]
+	queue chan dispatch
+}
+
+func newShard(queue int) *shard {
+	s := &shard{queue: make(chan dispatch, queue)}
+	s.tbl.Store(&table{idx: [2]map[string]*index{{}, {}}})
+	return s
+}
+
+func (s *shard) update(fn func(*table)) {
+	s.mu.Lock()
+	t := s.tbl.Load().clone()
+	fn(t)
+	s.tbl.Store(t)
+	s.mu.Unlock()
+}
+
+func (s *shard) run(done <-chan struct{}) {
+	for {
+		select {
+		case d := <-s.queue:
+			s.tbl.Load().each(d.ev, d.ordered, func(o *subOpts) { o.send(d.ev) })
+		case <-done:
+			return
+		}
+	}
+}
+
+// replay delivers ev waiting as long as needed; false once the
+// subscription has ended.
+func (o *subOpts) replay(ev models.OrderEvent) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.closed {
+		return false
+	}
+	select {
+	case o.ch <- ev:
+		return true
+	case <-o.done:
+		return false
+	}
+}
+
+// send applies the subscriber's slow-consumer policy. It reports false once
+// the subscription is closed or lagged.
+func (o *subOpts) send(ev models.OrderEvent) bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.closed || o.lag.lagged.Load() {
+		return false
+	}
+	ch := o.ch
+	select {
+	case ch <- ev:
+		return true
+	default:
+	}
+	switch o.policy {
+	case DropOldest:
+		// Replay may race the dispatcher for the freed slot; retry once.
+		for range 2 {
+			select {
+			case <-ch:
+				o.lag.skipped.Add(1)
+				dropsCtr.Inc()
+			default:
+			}
+			select {
+			case ch <- ev:
+				return true
+			default:
+			}
+		}
+	case Block:
+		t := time.NewTimer(o.timeout)
+		defer t.Stop()
+		select {
+		case ch <- ev:
+			return true
+		case <-t.C:
+		}
+	case Disconnect:
+		o.lag.skipped.Add(1)
+		o.lag.lagged.Store(true)
+		laggedCtr.Inc()
+		dropsCtr.Inc()
+		o.cancel()
+		return false
+	}
+	o.lag.skipped.Add(1)
+	dropsCtr.Inc()
+	return true
+}
@@ -0,0 +1,68 @@
+package stream
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// SlowPolicy decides what Publish does when a subscriber's buffer is full.
+type SlowPolicy int
+
+const (
+	DropNewest SlowPolicy = iota // discard the event being published
+	DropOldest                   // evict the oldest buffered event to make room
+	Disconnect                   // close the subscription and mark it lagged
+	Block                        // wait up to the block timeout, then drop newest
+)
+
+func (p SlowPolicy) String() string {
+	switch p {
+	case DropOldest:
+		return "drop-oldest"
+	case Disconnect:
+		return "disconnect"
+	case Block:
+		return "block"
+	}
+	return "drop-newest"
+}
+
+func ParseSlowPolicy(s string) (SlowPolicy, error) {
+	switch s {
+	case "", "drop-newest":
+		return DropNewest, nil
+	case "drop-oldest":
+		return DropOldest, nil
+	case "disconnect":
+		return Disconnect, nil
+	case "block":
+		return Block, nil
+	}
+	return DropNewest, fmt.Errorf("unknown slow consumer policy %q", s)
+}
+
+// Lag reports what a subscriber missed. Readers call Skipped after each
+// receive to learn how many events were dropped since the last call, and
+// Lagged once the channel closes to tell a disconnect from a normal end.
+type Lag struct {
+	skipped atomic.Uint64
+	lagged  atomic.Bool
+}
+
+func (l *Lag) Skipped() uint64 { return l.skipped.Swap(0) }
+func (l *Lag) Lagged() bool    { return l.lagged.Load() }
+
+// Policy sets the slow-consumer policy; timeout only applies to Block.
+func Policy(p SlowPolicy, timeout time.Duration) SubOption {
+	return func(o *subOpts) { o.policy, o.timeout, o.policySet = p, timeout, true }
+}
+
+// BlockTimeout shortens how long the hub's default block policy waits for
+// this subscriber; it cannot exceed the hub's timeout (see SetSlowPolicy).
+func BlockTimeout(d time.Duration) SubOption {
+	return func(o *subOpts) { o.maxWait = d }
+}
+
+// Track makes the subscriber's drop accounting visible through l.
+func Track(l *Lag) SubOption { return func(o *subOpts) { o.lag = l } }
@@ -0,0 +1,134 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+func publishN(t *testing.T, hub *Hub, from, n int) {
+	t.Helper()
+	for i := from; i < from+n; i++ {
+		if err := hub.Publish(models.OrderEvent{ID: fmt.Sprint("e", i), OrderID: "o-1", TS: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// drain reads what sub holds until it stays empty for a moment or closes.
+func drain(sub Subscriber) (ids []string, closed bool) {
+	for {
+		select {
+		case ev, ok := <-sub:
+			if !ok {
+				return ids, true
+			}
+			ids = append(ids, ev.ID)
+		case <-time.After(100 * time.Millisecond):
+			return ids, false
+		}
+	}
+}
+
+// waitSkipped waits until lag has counted n drops in total.
+func waitSkipped(t *testing.T, lag *Lag, n uint64) {
+	t.Helper()
+	var got uint64
+	deadline := time.Now().Add(5 * time.Second)
+	for got < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("skipped %d, want %d", got, n)
+		}
+		time.Sleep(5 * time.Millisecond)
+		got += lag.Skipped()
+	}
+	if got != n {
+		t.Fatalf("skipped %d, want %d", got, n)
+	}
+}
+
+func TestSlowPolicies(t *testing.T) {
+	tests := []struct {
+		policy  SlowPolicy
+		want    []string
+		skipped uint64
+		lagged  bool
+	}{
+		{DropNewest, []string{"e0", "e1"}, 2, false},
+		{DropOldest, []string{"e2", "e3"}, 2, false},
+		// Nothing is sent once the subscriber is lagged, so e3 is not counted.
+		{Disconnect, []string{"e0", "e1"}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			hub := NewHub(nil)
+			defer hub.Close()
+			lag := &Lag{}
+			sub := hub.Subscribe(context.Background(), 2, Policy(tt.policy, 0), Track(lag))
+			publishN(t, hub, 0, 4)
+			waitSkipped(t, lag, tt.skipped)
+
+			ids, closed := drain(sub)
+			if !slices.Equal(ids, tt.want) {
+				t.Fatalf("got %v, want %v", ids, tt.want)
+			}
+			if closed != tt.lagged || lag.Lagged() != tt.lagged {
+				t.Fatalf("closed %v, lagged %v, want %v", closed, lag.Lagged(), tt.lagged)
+			}
+		})
+	}
+}
+
+func TestBlockWaitsForReader(t *testing.T) {
+	hub := NewHub(nil)
+	defer hub.Close()
+	lag := &Lag{}
+	sub := hub.Subscribe(context.Background(), 1, Policy(Block, 5*time.Second), Track(lag))
+	publishN(t, hub, 0, 3)
+	time.Sleep(50 * time.Millisecond)
+	if ids, _ := drain(sub); !slices.Equal(ids, []string{"e0", "e1", "e2"}) {
+		t.Fatalf("got %v", ids)
+	}
+	if n := lag.Skipped(); n != 0 {
+		t.Fatalf("skipped %d", n)
+	}
+}
+
+func TestBlockReleasesAfterTimeout(t *testing.T) {
+	hub := NewHub(nil)
+	defer hub.Close()
+	const timeout = 100 * time.Millisecond
+	lag := &Lag{}
+	sub := hub.Subscribe(context.Background(), 1, Policy(Block, timeout), Track(lag))
+	start := time.Now()
+	publishN(t, hub, 0, 3)
+
+	// e0 fills the buffer; e1 and e2 each hold the dispatcher for the
+	// timeout and are then dropped.
+	waitSkipped(t, lag, 2)
+	if d := time.Since(start); d < 2*timeout {
+		t.Fatalf("dropped after %v, before the block timeout", d)
+	}
+	if ids, _ := drain(sub); !slices.Equal(ids, []string{"e0"}) {
+		t.Fatalf("got %v", ids)
+	}
+	// The dispatcher is free again.
+	publishN(t, hub, 3, 1)
+	if ids, _ := drain(sub); !slices.Equal(ids, []string{"e3"}) {
+		t.Fatalf("got %v after the block", ids)
+	}
+}
+
+func TestBlockTimeoutIsCapped(t *testing.T) {
+	hub := NewHub(nil)
+	defer hub.Close()
+	hub.SetSlowPolicy(Block, time.Minute)
+	lag := &Lag{}
+	hub.Subscribe(context.Background(), 1, BlockTimeout(50*time.Millisecond), Track(lag))
+	publishN(t, hub, 0, 2)
+	waitSkipped(t, lag, 1)
+}
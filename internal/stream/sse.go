@@ -2,17 +2,44 @@ package stream
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
-	"strings"
 	"time"
 
 	"orderpulse-api/internal/models"
 )
 
-func parseSince(r *http.Request) time.Time {
+// Since is where a stream resumes: Last-Event-ID, else ?since= as a
+// duration ago or an RFC 3339 time, no further back than WithMaxReplay
+// allows; zero for no replay.
+func Since(r *http.Request) time.Time {
+	t, _ := Resume(r)
+	return t
+}
+
+// Resume is Since that also reports whether the request asked to go further
+// back than allowed.
+func Resume(r *http.Request) (time.Time, bool) {
+	t := requestedSince(r)
+	if d, _ := r.Context().Value(maxReplayKey{}).(time.Duration); d > 0 && !t.IsZero() {
+		if floor := time.Now().Add(-d); t.Before(floor) {
+			return floor, true
+		}
+	}
+	return t, false
+}
+
+type maxReplayKey struct{}
+
+// WithMaxReplay makes streams resume no further back than d ago; older
+// requests are moved up and told so with a truncated notice.
+func WithMaxReplay(ctx context.Context, d time.Duration) context.Context {
+	return context.WithValue(ctx, maxReplayKey{}, d)
+}
+
+func requestedSince(r *http.Request) time.Time {
 	if id := r.Header.Get("Last-Event-ID"); id != "" {
 		if ns, err := strconv.ParseInt(id, 10, 64); err == nil {
 			return time.Unix(0, ns)
@@ -29,6 +56,40 @@ func parseSince(r *http.Request) time.Time {
 	return time.Time{}
 }
 
+// QueryOptions reads the filter (channels, orderIds, types, statuses,
+// filter), ordered, slow and blockTimeout from a stream URL. Clients cannot
+// pick block: a reader that stalls would hold up every subscriber on its
+// shard. blockTimeout only shortens the operator's block timeout when
+// STREAM_SLOW_POLICY is block.
+func QueryOptions(q url.Values) ([]SubOption, error) {
+	f := FilterFromQuery(q)
+	if err := f.Compile(); err != nil {
+		return nil, err
+	}
+	opts := []SubOption{Filtered(f)}
+	if ordered, _ := strconv.ParseBool(q.Get("ordered")); ordered {
+		opts = append(opts, Ordered())
+	}
+	if s := q.Get("slow"); s != "" {
+		p, err := ParseSlowPolicy(s)
+		if err != nil {
+			return nil, err
+		}
+		if p == Block {
+			return nil, fmt.Errorf("slow=block can only be set by the operator (STREAM_SLOW_POLICY)")
+		}
+		opts = append(opts, Policy(p, 0))
+	}
+	if t := q.Get("blockTimeout"); t != "" {
+		timeout, err := time.ParseDuration(t)
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("invalid blockTimeout %q", t)
+		}
+		opts = append(opts, BlockTimeout(timeout))
+	}
+	return opts, nil
+}
+
 func SSE(hub *Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
@@ -36,46 +97,38 @@ func SSE(hub *Hub) http.HandlerFunc {
 		w.Header().Set("Connection", "keep-alive")
 		w.Header().Set("X-Accel-Buffering", "no")
 
-		types := map[string]struct{}{}
-		statuses := map[string]struct{}{}
-		for _, t := range strings.Split(r.URL.Query().Get("types"), ",") {
-			if t = strings.TrimSpace(t); t != "" {
-				types[t] = struct{}{}
-			}
-		}
-		for _, s := range strings.Split(r.URL.Query().Get("statuses"), ",") {
-			if s = strings.TrimSpace(s); s != "" {
-				statuses[s] = struct{}{}
-			}
+		opts, err := QueryOptions(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		filter := func(e models.OrderEvent) bool {
-			if len(types) > 0 {
-				if _, ok := types[e.Type]; !ok {
-					return false
-				}
-			}
-			if len(statuses) > 0 {
-				if _, ok := statuses[e.Status]; !ok {
-					return false
-				}
-			}
-			return true
+		proj, err := ProjectionFromQuery(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+		lag := &Lag{}
+		opts = append(opts, Track(lag))
+		throttle := throttleFrom(r.Context())
 
 		ctx, cancel := context.WithCancel(r.Context())
 		defer cancel()
-		sub := hub.Subscribe(ctx, 512)
-
-		if since := parseSince(r); !since.IsZero() {
-			hub.ReplaySince(since, sub)
-		}
-
 		flusher, ok := w.(http.Flusher)
 		if !ok {
 			http.Error(w, "stream unsupported", http.StatusInternalServerError)
 			return
 		}
 
+		sub := hub.Subscribe(ctx, 512, opts...)
+
+		if since, truncated := Resume(r); !since.IsZero() {
+			if truncated {
+				_, _ = fmt.Fprintf(w, "event: truncated\ndata: {\"since\":%q}\n\n", since.UTC().Format(time.RFC3339Nano))
+				flusher.Flush()
+			}
+			go hub.ReplaySince(since, sub)
+		}
+
 		ping := time.NewTicker(15 * time.Second)
 		defer ping.Stop()
 
@@ -84,18 +137,71 @@ func SSE(hub *Hub) http.HandlerFunc {
 			case <-ctx.Done():
 				return
 			case <-ping.C:
+				writeSkipped(w, lag)
 				_, _ = fmt.Fprintf(w, ": ping\n\n")
 				flusher.Flush()
-			case ev := <-sub:
-				if !filter(ev) {
-					break
+			case ev, ok := <-sub:
+				if !ok {
+					if lag.Lagged() {
+						_, _ = fmt.Fprintf(w, "event: lagged\ndata: {\"skipped\":%d}\n\n", lag.Skipped())
+						flusher.Flush()
+					}
+					return
+				}
+				if throttle != nil && throttle.Wait(ctx) != nil {
+					return
 				}
-				b, _ := json.Marshal(ev)
-				_, _ = fmt.Fprintf(w, "id: %d\n", ev.TS.UnixNano())
-				_, _ = fmt.Fprintf(w, "event: order\n")
-				_, _ = fmt.Fprintf(w, "data: %s\n\n", b)
+				writeSkipped(w, lag)
+				_, _ = w.Write(SSEFrame(proj, ev))
 				flusher.Flush()
 			}
 		}
 	}
 }
+
+// SSEFrame returns ev as a complete SSE message (id, event name, data)
+// under p, built once per event and shared by every stream using p.
+func SSEFrame(p Projection, ev models.OrderEvent) []byte {
+	return p.Cached(ev, "sse", func(payload []byte) any {
+		b := make([]byte, 0, len(payload)+64)
+		b = append(b, "id: "...)
+		b = strconv.AppendInt(b, ev.TS.UnixNano(), 10)
+		b = append(b, "\nevent: "...)
+		switch ch := ChannelOf(ev); {
+		case ev.Late:
+			b = append(b, "late"...)
+		case ch == DefaultChannel:
+			b = append(b, "order"...)
+		default:
+			b = append(b, ch...)
+		}
+		b = append(b, "\ndata: "...)
+		b = append(b, payload...)
+		return append(b, "\n\n"...)
+	}).([]byte)
+}
+
+// Throttle paces delivery on a stream, e.g. a quota lease.
+type Throttle interface {
+	Wait(ctx context.Context) error
+}
+
+type throttleKey struct{}
+
+// WithThrottle makes SSE wait on t before writing each event.
+func WithThrottle(ctx context.Context, t Throttle) context.Context {
+	return context.WithValue(ctx, throttleKey{}, t)
+}
+
+func throttleFrom(ctx context.Context) Throttle {
+	t, _ := ctx.Value(throttleKey{}).(Throttle)
+	return t
+}
+
+// writeSkipped tells the client how many events it missed since the last
+// notice so it can resync (e.g. reconnect with Last-Event-ID).
+func writeSkipped(w http.ResponseWriter, lag *Lag) {
+	if n := lag.Skipped(); n > 0 {
+		_, _ = fmt.Fprintf(w, "event: skipped\ndata: {\"skipped\":%d}\n\n", n)
+	}
+}
@@ -0,0 +1,379 @@
+package subscription
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+	"orderpulse-api/internal/models"
+	"orderpulse-api/internal/output"
+	"orderpulse-api/internal/stream"
+)
+
+var (
+	deliveryCtr = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "subscription_deliveries_total",
+		Help: "webhook subscription delivery attempts by result, and events dropped while an endpoint was slow",
+	}, []string{"result"})
+	activeGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "subscriptions_active",
+		Help: "enabled webhook subscriptions",
+	})
+)
+
+func init() { prometheus.MustRegister(deliveryCtr, activeGauge) }
+
+var ErrNotFound = errors.New("subscription not found")
+
+// Delivery is one attempt to deliver an event, kept in a bounded per
+// subscription log. Entries with Dropped set record events that matched
+// but were discarded because the buffer was full.
+type Delivery struct {
+	EventID    string    `json:"eventId,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`
+	Dropped    uint64    `json:"dropped,omitempty"`
+	Status     int       `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+	At         time.Time `json:"at"`
+}
+
+type Subscription struct {
+	ID        string        `json:"id"`
+	Owner     string        `json:"owner"`
+	URL       string        `json:"url"`
+	Secret    string        `json:"secret,omitempty"`
+	Filter    stream.Filter `json:"filter"`
+	Enabled   bool          `json:"enabled"`
+	Failures  int           `json:"failures"`
+	Disabled  string        `json:"disabledReason,omitempty"`
+	CreatedAt time.Time     `json:"createdAt"`
+	Log       []Delivery    `json:"deliveries,omitempty"`
+}
+
+// Public hides the secret and delivery log.
+func (s Subscription) Public() Subscription {
+	s.Secret, s.Log = "", nil
+	return s
+}
+
+type Options struct {
+	Path        string
+	Buffer      int
+	MaxRetries  int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	MaxFailures int // consecutive failed events before auto-disable
+	LogSize     int
+	Timeout     time.Duration
+	// AllowPrivate lets subscriptions target plain http and non-public
+	// addresses, for development only.
+	AllowPrivate bool
+}
+
+// Manager runs one hub subscriber per enabled subscription and persists the
+// set to a JSON file.
+type Manager struct {
+	hub  *stream.Hub
+	opts Options
+
+	mu      sync.Mutex
+	ctx     context.Context
+	subs    map[string]*Subscription
+	cancels map[string]context.CancelFunc
+}
+
+func New(hub *stream.Hub, opts Options) (*Manager, error) {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 256
+	}
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 5
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Minute
+	}
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = 10
+	}
+	if opts.LogSize <= 0 {
+		opts.LogSize = 50
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	m := &Manager{hub: hub, opts: opts, subs: map[string]*Subscription{}, cancels: map[string]context.CancelFunc{}}
+	if opts.Path == "" {
+		return m, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(opts.Path), 0o755); err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(opts.Path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []*Subscription
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+	for _, s := range list {
+		m.subs[s.ID] = s
+	}
+	return m, nil
+}
+
+// Start launches workers for enabled subscriptions; they stop with ctx.
+func (m *Manager) Start(ctx context.Context) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ctx = ctx
+	for _, s := range m.subs {
+		if s.Enabled {
+			m.startLocked(s)
+		}
+	}
+}
+
+func (m *Manager) startLocked(s *Subscription) {
+	if m.ctx == nil || m.cancels[s.ID] != nil {
+		return
+	}
+	wh, err := m.webhook(s.URL, s.Secret, map[string]string{"X-Subscription-Id": s.ID}, m.opts.Timeout)
+	if err != nil {
+		log.Error().Err(err).Str("subscription", s.ID).Msg("subscription start")
+		return
+	}
+	ctx, cancel := context.WithCancel(m.ctx)
+	m.cancels[s.ID] = cancel
+	activeGauge.Inc()
+	go m.run(ctx, s.ID, s.Filter, wh)
+}
+
+// webhook builds the sink for a client-supplied URL.
+func (m *Manager) webhook(url, secret string, headers map[string]string, timeout time.Duration) (*output.Webhook, error) {
+	if m.opts.AllowPrivate {
+		return output.NewWebhook(url, secret, headers, timeout)
+	}
+	return output.NewPublicWebhook(url, secret, headers, timeout)
+}
+
+func (m *Manager) stopLocked(id string) {
+	if cancel := m.cancels[id]; cancel != nil {
+		cancel()
+		delete(m.cancels, id)
+		activeGauge.Dec()
+	}
+}
+
+// run delivers one event at a time, so while an event is being retried
+// new ones queue in the buffer. Once it is full they are dropped rather than
+// stalling the hub (whatever STREAM_SLOW_POLICY says), and the drops are
+// recorded before the next delivery.
+func (m *Manager) run(ctx context.Context, id string, filter stream.Filter, wh *output.Webhook) {
+	lag := &stream.Lag{}
+	sub := m.hub.Subscribe(ctx, m.opts.Buffer, stream.Filtered(filter), stream.Policy(stream.DropNewest, 0), stream.Track(lag))
+	for ev := range sub {
+		if n := lag.Skipped(); n > 0 {
+			m.dropped(id, n)
+		}
+		m.deliver(ctx, id, wh, ev)
+	}
+}
+
+func (m *Manager) deliver(ctx context.Context, id string, wh *output.Webhook, ev models.OrderEvent) {
+	backoff := m.opts.Backoff
+	deliveryID := id + ":" + ev.ID
+	for attempt := 1; ; attempt++ {
+		res, err := wh.Deliver(ctx, deliveryID, []models.OrderEvent{ev})
+		if ctx.Err() != nil {
+			return
+		}
+		d := Delivery{EventID: ev.ID, Attempt: attempt, Status: res.Status, DurationMs: res.Duration.Milliseconds(), At: time.Now().UTC()}
+		if err != nil {
+			d.Error = err.Error()
+		}
+		var perm *output.PermanentError
+		final := err == nil || attempt > m.opts.MaxRetries || errors.As(err, &perm)
+		m.record(id, d, err == nil, final)
+		if final {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, m.opts.MaxBackoff)
+	}
+}
+
+// record appends to the delivery log and, once an event has exhausted its
+// retries, counts it towards auto-disable.
+func (m *Manager) record(id string, d Delivery, ok, final bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.subs[id]
+	if s == nil {
+		return
+	}
+	m.appendLocked(s, d)
+	switch {
+	case ok:
+		deliveryCtr.WithLabelValues("ok").Inc()
+		s.Failures = 0
+	case final:
+		deliveryCtr.WithLabelValues("failed").Inc()
+		s.Failures++
+		if s.Failures >= m.opts.MaxFailures {
+			s.Enabled = false
+			s.Disabled = "too many failures: " + d.Error
+			m.stopLocked(id)
+			log.Warn().Str("subscription", id).Str("url", s.URL).Msg("subscription disabled")
+			m.saveLocked()
+		}
+	default:
+		deliveryCtr.WithLabelValues("retry").Inc()
+	}
+}
+
+func (m *Manager) dropped(id string, n uint64) {
+	deliveryCtr.WithLabelValues("dropped").Add(float64(n))
+	log.Warn().Str("subscription", id).Uint64("dropped", n).Msg("subscription behind")
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s := m.subs[id]; s != nil {
+		m.appendLocked(s, Delivery{Dropped: n, Error: "buffer full while the endpoint was slow", At: time.Now().UTC()})
+	}
+}
+
+func (m *Manager) appendLocked(s *Subscription, d Delivery) {
+	s.Log = append(s.Log, d)
+	if len(s.Log) > m.opts.LogSize {
+		s.Log = s.Log[len(s.Log)-m.opts.LogSize:]
+	}
+}
+
+func (m *Manager) Create(owner, url, secret string, filter stream.Filter) (Subscription, error) {
+	if _, err := m.webhook(url, "", nil, 0); err != nil {
+		return Subscription{}, err
+	}
+	if err := filter.Compile(); err != nil {
+		return Subscription{}, err
+	}
+	if secret == "" {
+		b := make([]byte, 24)
+		_, _ = rand.Read(b)
+		secret = hex.EncodeToString(b)
+	}
+	s := &Subscription{
+		ID: uuid.NewString(), Owner: owner, URL: url, Secret: secret, Filter: filter,
+		Enabled: true, CreatedAt: time.Now().UTC(),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subs[s.ID] = s
+	m.startLocked(s)
+	return *s, m.saveLocked()
+}
+
+// List returns owner's subscriptions, or all of them for an empty owner.
+func (m *Manager) List(owner string) []Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []Subscription{}
+	for _, s := range m.subs {
+		if owner == "" || s.Owner == owner {
+			out = append(out, s.Public())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out
+}
+
+// Get returns a copy including the delivery log. Subscriptions owned by
+// someone else are reported as missing unless owner is empty.
+func (m *Manager) Get(owner, id string) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.subs[id]
+	if s == nil || (owner != "" && s.Owner != owner) {
+		return Subscription{}, ErrNotFound
+	}
+	c := *s
+	c.Log = append([]Delivery(nil), s.Log...)
+	return c, nil
+}
+
+// SetEnabled re-enables (resetting the failure count) or pauses a
+// subscription.
+func (m *Manager) SetEnabled(owner, id string, enabled bool) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.subs[id]
+	if s == nil || (owner != "" && s.Owner != owner) {
+		return Subscription{}, ErrNotFound
+	}
+	s.Enabled = enabled
+	if enabled {
+		s.Failures, s.Disabled = 0, ""
+		m.startLocked(s)
+	} else {
+		s.Disabled = "paused"
+		m.stopLocked(id)
+	}
+	return s.Public(), m.saveLocked()
+}
+
+func (m *Manager) Delete(owner, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := m.subs[id]
+	if s == nil || (owner != "" && s.Owner != owner) {
+		return ErrNotFound
+	}
+	m.stopLocked(id)
+	delete(m.subs, id)
+	return m.saveLocked()
+}
+
+func (m *Manager) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.saveLocked()
+}
+
+func (m *Manager) saveLocked() error {
+	if m.opts.Path == "" {
+		return nil
+	}
+	list := make([]*Subscription, 0, len(m.subs))
+	for _, s := range m.subs {
+		list = append(list, s)
+	}
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := m.opts.Path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, m.opts.Path)
+}
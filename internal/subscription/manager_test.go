@@ -0,0 +1,181 @@
+package subscription
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"orderpulse-api/internal/models"
+	"orderpulse-api/internal/stream"
+)
+
+// endpoint answers every delivery with status and records the delivery IDs
+// it saw.
+type endpoint struct {
+	status atomic.Int32
+	mu     sync.Mutex
+	ids    []string
+}
+
+func newEndpoint(t *testing.T, status int) (*endpoint, string) {
+	e := &endpoint{}
+	e.status.Store(int32(status))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e.mu.Lock()
+		e.ids = append(e.ids, r.Header.Get("X-Delivery-Id"))
+		e.mu.Unlock()
+		w.WriteHeader(int(e.status.Load()))
+	}))
+	t.Cleanup(srv.Close)
+	return e, srv.URL
+}
+
+func (e *endpoint) hits() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.ids)
+}
+
+func start(t *testing.T, opts Options) (*Manager, *stream.Hub) {
+	t.Helper()
+	hub := stream.NewHub(nil)
+	t.Cleanup(hub.Close)
+	opts.AllowPrivate = true
+	opts.Backoff, opts.MaxBackoff = 20*time.Millisecond, 20*time.Millisecond
+	m, err := New(hub, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	m.Start(ctx)
+	return m, hub
+}
+
+func publish(t *testing.T, hub *stream.Hub, id string) {
+	t.Helper()
+	if err := hub.Publish(models.OrderEvent{ID: id, OrderID: "o-1", Status: "paid", TS: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// subscribed publishes warmup events until e has seen one, since the
+// subscription's hub subscriber starts asynchronously.
+func subscribed(t *testing.T, hub *stream.Hub, e *endpoint) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for e.hits() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("subscription never delivered")
+		}
+		publish(t, hub, "warmup")
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRetriesWithStableDeliveryID(t *testing.T) {
+	e, url := newEndpoint(t, http.StatusOK)
+	m, hub := start(t, Options{MaxRetries: 3})
+	s, err := m.Create("alice", url, "", stream.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscribed(t, hub, e)
+	e.status.Store(http.StatusServiceUnavailable)
+	publish(t, hub, "e1")
+	eventually(t, "retries", func() bool {
+		got, _ := m.Get("", s.ID)
+		n := 0
+		for _, d := range got.Log {
+			if d.EventID == "e1" {
+				n++
+			}
+		}
+		return n == 4
+	})
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, id := range e.ids[len(e.ids)-4:] {
+		if id != s.ID+":e1" {
+			t.Fatalf("delivery id %q, want %q on every retry", id, s.ID+":e1")
+		}
+	}
+}
+
+func TestFailingEndpointRecordsDrops(t *testing.T) {
+	e, url := newEndpoint(t, http.StatusOK)
+	m, hub := start(t, Options{Buffer: 2, MaxRetries: 1, MaxFailures: 100})
+	s, err := m.Create("alice", url, "", stream.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscribed(t, hub, e)
+	e.status.Store(http.StatusInternalServerError)
+
+	// Each event takes two attempts and a backoff, so most of these arrive
+	// while the buffer is full.
+	const n = 10
+	for i := range n {
+		publish(t, hub, fmt.Sprint("e", i))
+	}
+	var dropped uint64
+	eventually(t, "every event delivered or dropped", func() bool {
+		got, _ := m.Get("", s.ID)
+		dropped = 0
+		final := map[string]bool{}
+		for _, d := range got.Log {
+			dropped += d.Dropped
+			if strings.HasPrefix(d.EventID, "e") && d.Attempt == 2 {
+				final[d.EventID] = true
+			}
+		}
+		return uint64(len(final))+dropped == n
+	})
+	if dropped == 0 {
+		t.Fatal("no drops recorded")
+	}
+}
+
+func TestDisablesAfterMaxFailures(t *testing.T) {
+	e, url := newEndpoint(t, http.StatusOK)
+	m, hub := start(t, Options{MaxRetries: 1, MaxFailures: 2})
+	s, err := m.Create("alice", url, "", stream.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subscribed(t, hub, e)
+	// A 4xx other than 408/429 is permanent: no retries.
+	e.status.Store(http.StatusGone)
+	publish(t, hub, "e1")
+	eventually(t, "first failure", func() bool { got, _ := m.Get("", s.ID); return got.Failures == 1 })
+	publish(t, hub, "e2")
+	eventually(t, "disabled", func() bool { got, _ := m.Get("", s.ID); return !got.Enabled })
+
+	got, _ := m.Get("", s.ID)
+	if !strings.HasPrefix(got.Disabled, "too many failures") {
+		t.Fatalf("disabled reason %q", got.Disabled)
+	}
+	if _, err := m.SetEnabled("bob", s.ID, true); err != ErrNotFound {
+		t.Fatalf("other owner re-enabled: %v", err)
+	}
+	if got, err := m.SetEnabled("alice", s.ID, true); err != nil || !got.Enabled || got.Failures != 0 {
+		t.Fatalf("re-enable: %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"orderpulse-api/internal/codec"
+	"orderpulse-api/internal/models"
+)
+
+// Amounts from platforms are converted to minor units (cents).
+
+// shopify verifies X-Shopify-Hmac-Sha256, which covers the body only: the
+// webhook ID, topic and X-Shopify-Triggered-At headers are not signed, so a
+// captured body could be resent with fresh ones. Identity therefore comes
+// from the body (order id and updated_at), so a replay is the same delivery,
+// refused while the receiver remembers it, and the same event ID for dedup
+// after that. There is no signed timestamp for the replay window to check.
+type shopify struct{}
+
+type shopifyOrder struct {
+	ID                json.Number `json:"id"`
+	FinancialStatus   string      `json:"financial_status"`
+	FulfillmentStatus string      `json:"fulfillment_status"`
+	TotalPrice        string      `json:"total_price"`
+	CancelledAt       string      `json:"cancelled_at"`
+	UpdatedAt         time.Time   `json:"updated_at"`
+}
+
+func parseShopify(body []byte) (shopifyOrder, string, error) {
+	var o shopifyOrder
+	if err := json.Unmarshal(body, &o); err != nil {
+		return o, "", err
+	}
+	if o.ID == "" {
+		return o, "", errors.New("missing order id")
+	}
+	if o.UpdatedAt.IsZero() {
+		return o, "", errors.New("missing updated_at")
+	}
+	return o, o.ID.String() + ":" + strconv.FormatInt(o.UpdatedAt.UnixNano(), 10), nil
+}
+
+func (shopify) Verify(h http.Header, body []byte, secrets []string) (Delivery, error) {
+	sig, err := base64.StdEncoding.DecodeString(h.Get("X-Shopify-Hmac-Sha256"))
+	if err != nil || !anyMatch(secrets, sig, body) {
+		return Delivery{}, ErrSignature
+	}
+	// A body that does not parse has no ID; Events rejects it.
+	_, id, _ := parseShopify(body)
+	return Delivery{ID: id}, nil
+}
+
+var shopifyTypes = map[string]string{
+	"orders/create":    "order.created",
+	"orders/updated":   "status_changed",
+	"orders/paid":      "status_changed",
+	"orders/cancelled": "status_changed",
+	"orders/fulfilled": "order.shipped",
+}
+
+func (shopify) Events(h http.Header, body []byte) ([]models.OrderEvent, error) {
+	o, id, err := parseShopify(body)
+	if err != nil {
+		return nil, err
+	}
+	// The topic only picks the event type; status and identity come from
+	// the signed body.
+	typ, ok := shopifyTypes[h.Get("X-Shopify-Topic")]
+	if !ok {
+		typ = "status_changed"
+	}
+	status := o.FinancialStatus
+	switch {
+	case o.CancelledAt != "":
+		status = "cancelled"
+	case o.FulfillmentStatus == "fulfilled":
+		status = "shipped"
+	case status == "":
+		status = "pending"
+	}
+	amount, _ := minorUnits(o.TotalPrice)
+	return []models.OrderEvent{{
+		ID: "shopify:" + id, OrderID: o.ID.String(), Type: typ, Status: status, Amount: amount, TS: o.UpdatedAt.UTC(),
+	}}, nil
+}
+
+type stripe struct{}
+
+// Verify implements the Stripe-Signature scheme: t=<unix>,v1=<hex>[,v1=...]
+// over "<t>.<body>".
+func (stripe) Verify(h http.Header, body []byte, secrets []string) (Delivery, error) {
+	var ts string
+	var sigs [][]byte
+	for _, part := range strings.Split(h.Get("Stripe-Signature"), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			if b, err := hex.DecodeString(v); err == nil {
+				sigs = append(sigs, b)
+			}
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return Delivery{}, ErrSignature
+	}
+	for _, sig := range sigs {
+		if anyMatch(secrets, sig, []byte(ts), []byte("."), body) {
+			var e struct {
+				ID string `json:"id"`
+			}
+			_ = json.Unmarshal(body, &e)
+			return Delivery{ID: e.ID, TS: time.Unix(sec, 0)}, nil
+		}
+	}
+	return Delivery{}, ErrSignature
+}
+
+var stripeStatus = map[string]string{
+	"checkout.session.completed":    "paid",
+	"payment_intent.succeeded":      "paid",
+	"payment_intent.processing":     "pending",
+	"payment_intent.payment_failed": "failed",
+	"payment_intent.canceled":       "cancelled",
+	"charge.refunded":               "refunded",
+}
+
+func (stripe) Events(_ http.Header, body []byte) ([]models.OrderEvent, error) {
+	var e struct {
+		ID      string `json:"id"`
+		Type    string `json:"type"`
+		Created int64  `json:"created"`
+		Data    struct {
+			Object struct {
+				ID          string            `json:"id"`
+				Amount      int               `json:"amount"`
+				AmountTotal int               `json:"amount_total"`
+				Status      string            `json:"status"`
+				Metadata    map[string]string `json:"metadata"`
+			} `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil {
+		return nil, err
+	}
+	status, ok := stripeStatus[e.Type]
+	if !ok {
+		// Not an order-related event; acknowledged but ignored.
+		return nil, nil
+	}
+	obj := e.Data.Object
+	orderID := obj.Metadata["order_id"]
+	if orderID == "" {
+		orderID = obj.ID
+	}
+	amount := obj.AmountTotal
+	if amount == 0 {
+		amount = obj.Amount
+	}
+	return []models.OrderEvent{{
+		ID: "stripe:" + e.ID, OrderID: orderID, Type: "status_changed", Status: status, Amount: amount,
+		TS: time.Unix(e.Created, 0).UTC(),
+	}}, nil
+}
+
+// generic accepts OrderEvent-shaped JSON (object or array) signed as
+// X-Signature: sha256=<hex of HMAC("<X-Timestamp>.<body>")>.
+type generic struct{}
+
+func (generic) Verify(h http.Header, body []byte, secrets []string) (Delivery, error) {
+	sig, err := hex.DecodeString(strings.TrimPrefix(h.Get("X-Signature"), "sha256="))
+	ts := h.Get("X-Timestamp")
+	sec, terr := strconv.ParseInt(ts, 10, 64)
+	if err != nil || terr != nil || !anyMatch(secrets, sig, []byte(ts), []byte("."), body) {
+		return Delivery{}, ErrSignature
+	}
+	return Delivery{ID: h.Get("X-Delivery-Id"), TS: time.Unix(sec, 0)}, nil
+}
+
+func (generic) Events(_ http.Header, body []byte) ([]models.OrderEvent, error) {
+	var docs []map[string]any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if b := bytes.TrimSpace(body); len(b) > 0 && b[0] == '[' {
+		if err := dec.Decode(&docs); err != nil {
+			return nil, err
+		}
+	} else {
+		doc := map[string]any{}
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+		docs = append(docs, doc)
+	}
+	out := make([]models.OrderEvent, 0, len(docs))
+	for _, d := range docs {
+		ev, err := codec.ToEvent(d)
+		if err != nil {
+			return nil, err
+		}
+		if ev.TS.IsZero() {
+			ev.TS = time.Now().UTC()
+		}
+		out = append(out, ev)
+	}
+	return out, nil
+}
+
+func minorUnits(s string) (int, error) {
+	whole, frac, _ := strings.Cut(strings.TrimSpace(s), ".")
+	frac = (frac + "00")[:2]
+	return strconv.Atoi(whole + frac)
+}
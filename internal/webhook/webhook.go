@@ -0,0 +1,153 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"orderpulse-api/internal/models"
+)
+
+var (
+	ErrUnknownSource = errors.New("unknown webhook source")
+	ErrSignature     = errors.New("invalid signature")
+	ErrReplay        = errors.New("delivery outside replay window or already seen")
+)
+
+// Delivery is what an adapter extracts from the request while verifying it.
+type Delivery struct {
+	ID string
+	TS time.Time
+}
+
+// Adapter verifies one platform's signature scheme and maps its payloads.
+// Verify receives every active secret so keys can be rotated without
+// dropping deliveries.
+type Adapter interface {
+	Verify(h http.Header, body []byte, secrets []string) (Delivery, error)
+	Events(h http.Header, body []byte) ([]models.OrderEvent, error)
+}
+
+var adapters = map[string]Adapter{
+	"shopify": shopify{},
+	"stripe":  stripe{},
+	"generic": generic{},
+}
+
+func Lookup(name string) (Adapter, bool) {
+	a, ok := adapters[name]
+	return a, ok
+}
+
+type Source struct {
+	Name    string
+	Adapter Adapter
+	Secrets map[string]string
+}
+
+type Receiver struct {
+	window  time.Duration
+	sources map[string]Source
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewReceiver(window time.Duration, sources ...Source) *Receiver {
+	r := &Receiver{window: window, sources: map[string]Source{}, seen: map[string]time.Time{}}
+	for _, s := range sources {
+		r.sources[s.Name] = s
+	}
+	return r
+}
+
+func (r *Receiver) Sources() []string {
+	out := make([]string, 0, len(r.sources))
+	for n := range r.sources {
+		out = append(out, n)
+	}
+	return out
+}
+
+// Receive verifies and maps a delivery, recording its ID as seen. Callers
+// that then fail to publish must Forget it so the platform's retry is
+// accepted.
+func (r *Receiver) Receive(source string, h http.Header, body []byte) (Delivery, []models.OrderEvent, error) {
+	src, ok := r.sources[source]
+	if !ok {
+		return Delivery{}, nil, ErrUnknownSource
+	}
+	secrets := make([]string, 0, len(src.Secrets))
+	for _, s := range src.Secrets {
+		secrets = append(secrets, s)
+	}
+	d, err := src.Adapter.Verify(h, body, secrets)
+	if err != nil {
+		return d, nil, err
+	}
+	if err := r.checkReplay(source, d); err != nil {
+		return d, nil, err
+	}
+	evs, err := src.Adapter.Events(h, body)
+	if err != nil {
+		r.Forget(source, d)
+		return d, nil, fmt.Errorf("%s payload: %w", source, err)
+	}
+	return d, evs, nil
+}
+
+// Forget removes d from the seen set.
+func (r *Receiver) Forget(source string, d Delivery) {
+	if d.ID == "" {
+		return
+	}
+	r.mu.Lock()
+	delete(r.seen, source+"/"+d.ID)
+	r.mu.Unlock()
+}
+
+// checkReplay rejects deliveries whose timestamp falls outside the window and
+// delivery IDs already seen within it.
+func (r *Receiver) checkReplay(source string, d Delivery) error {
+	now := time.Now()
+	if !d.TS.IsZero() && (d.TS.Before(now.Add(-r.window)) || d.TS.After(now.Add(r.window))) {
+		return ErrReplay
+	}
+	if d.ID == "" {
+		return nil
+	}
+	key := source + "/" + d.ID
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.seen[key]; dup {
+		return ErrReplay
+	}
+	for k, at := range r.seen {
+		if now.Sub(at) > r.window {
+			delete(r.seen, k)
+		}
+	}
+	r.seen[key] = now
+	return nil
+}
+
+func sign(secret string, parts ...[]byte) []byte {
+	m := hmac.New(sha256.New, []byte(secret))
+	for _, p := range parts {
+		m.Write(p)
+	}
+	return m.Sum(nil)
+}
+
+func anyMatch(secrets []string, sig []byte, parts ...[]byte) bool {
+	for _, s := range secrets {
+		if hmac.Equal(sign(s, parts...), sig) {
+			return true
+		}
+	}
+	return false
+}
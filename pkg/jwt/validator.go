@@ -2,6 +2,7 @@ package jwt
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	jwtv5 "github.com/golang-jwt/jwt/v5"
@@ -16,12 +17,44 @@ func New(keys map[string]string, skew time.Duration) *Validator {
 	return &Validator{keys: keys, skew: skew}
 }
 
+// Claims is the subset of token claims used for authorization. Anon is set
+// when no keys are configured and every token is accepted; it grants no
+// scopes, so only endpoints that need none (the streams) are open.
+type Claims struct {
+	Subject string
+	Tenant  string
+	Scopes  []string
+	Roles   []string
+	Anon    bool
+}
+
+// Has reports whether the scope or role s was granted; anonymous (dev mode)
+// claims grant nothing.
+func (c Claims) Has(s string) bool {
+	for _, x := range c.Scopes {
+		if x == s {
+			return true
+		}
+	}
+	for _, x := range c.Roles {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (v *Validator) Validate(token string) (string, error) {
+	c, err := v.ValidateClaims(token)
+	return c.Subject, err
+}
+
+func (v *Validator) ValidateClaims(token string) (Claims, error) {
 	if token == "" {
-		return "", errors.New("no token")
+		return Claims{}, errors.New("no token")
 	}
 	if len(v.keys) == 0 {
-		return "anon", nil
+		return Claims{Subject: "anon", Anon: true}, nil
 	}
 
 	parser := jwtv5.NewParser(jwtv5.WithValidMethods([]string{jwtv5.SigningMethodHS256.Alg()}))
@@ -39,12 +72,12 @@ func (v *Validator) Validate(token string) (string, error) {
 		return []byte(sec), nil
 	})
 	if err != nil || !tok.Valid {
-		return "", errors.New("invalid")
+		return Claims{}, errors.New("invalid")
 	}
 
 	claims, ok := tok.Claims.(jwtv5.MapClaims)
 	if !ok {
-		return "", errors.New("claims")
+		return Claims{}, errors.New("claims")
 	}
 
 	now := time.Now()
@@ -55,22 +88,42 @@ func (v *Validator) Validate(token string) (string, error) {
 
 	if expRaw, ok := claims["exp"]; ok {
 		if exp, err := toTime(expRaw); err == nil && now.After(exp.Add(v.skew)) {
-			return "", errors.New("expired")
+			return Claims{}, errors.New("expired")
 		}
 	}
 	if nbfRaw, ok := claims["nbf"]; ok {
 		if nbf, err := toTime(nbfRaw); err == nil && now.Add(v.skew).Before(nbf) {
-			return "", errors.New("not yet valid")
+			return Claims{}, errors.New("not yet valid")
 		}
 	}
 	if iatRaw, ok := claims["iat"]; ok {
 		if iat, err := toTime(iatRaw); err == nil && now.Before(iat.Add(-v.skew)) {
-			return "", errors.New("issued in the future")
+			return Claims{}, errors.New("issued in the future")
 		}
 	}
 
 	sub, _ := claims["sub"].(string)
-	return sub, nil
+	tenant, _ := claims["tenant"].(string)
+	return Claims{Subject: sub, Tenant: tenant, Scopes: stringList(claims["scope"], claims["scp"]), Roles: stringList(claims["roles"], claims["role"])}, nil
+}
+
+// stringList merges space-delimited strings and string arrays, the two
+// shapes scope and role claims come in.
+func stringList(vals ...any) []string {
+	var out []string
+	for _, v := range vals {
+		switch x := v.(type) {
+		case string:
+			out = append(out, strings.Fields(x)...)
+		case []any:
+			for _, e := range x {
+				if s, ok := e.(string); ok {
+					out = append(out, s)
+				}
+			}
+		}
+	}
+	return out
 }
 
 func toTime(x any) (time.Time, error) {